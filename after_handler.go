@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Правило "after <id> <дни>" привязывает задачу к выполнению другой задачи:
+// "оплатить счёт через 5 дней после доставки" — "after 12 5". Пока задача id
+// не выполнена, у зависимой задачи нет даты; её назначает отметка
+// выполнения задачи id. Модификатор "+b"/"!b" переносит такую дату на
+// ближайший рабочий день. Выполненная зависимая задача снова ждёт задачу
+// id; если той уже нет, зависимая удаляется. Задачу id нельзя удалить,
+// пока её ждут зависимые задачи.
+
+// maxAfterDays ограничивает смещение в правиле after.
+const maxAfterDays = 400
+
+// parseAfterRule разбирает части правила после слова "after": id задачи и
+// смещение в днях от дня её выполнения (0 — в тот же день).
+func parseAfterRule(repeat string, fields []ruleToken) (int64, int, error) {
+	if err := checkRuleFields(repeat, fields, 3, 3); err != nil {
+		return 0, 0, err
+	}
+	trigger, err := strconv.ParseInt(fields[1].text, 10, 64)
+	if err != nil || trigger < 1 {
+		return 0, 0, newRepeatError(errCodeInvalidValue, fields[1],
+			"некорректный id задачи в правиле 'after': %s", fields[1].text)
+	}
+	days, err := strconv.Atoi(fields[2].text)
+	if err != nil || days < 0 || days > maxAfterDays {
+		return 0, 0, newRepeatError(errCodeInvalidValue, fields[2],
+			"число дней в правиле 'after' должно быть от 0 до %d: %s", maxAfterDays, fields[2].text)
+	}
+	return trigger, days, nil
+}
+
+// afterRule возвращает задачу, от выполнения которой зависит правило, и
+// смещение в днях; ok == false, если это не правило after или оно неверно.
+func afterRule(repeat string) (trigger int64, days int, modifier ruleToken, ok bool) {
+	fields := ruleFields(repeat)
+	if n := len(fields); n > 0 && isDayModifier(fields[n-1].text) {
+		modifier = fields[n-1]
+		fields = fields[:n-1]
+	}
+	if len(fields) == 0 || fields[0].text != "after" {
+		return 0, 0, modifier, false
+	}
+	trigger, days, err := parseAfterRule(repeat, fields)
+	return trigger, days, modifier, err == nil
+}
+
+// dependentDate возвращает дату зависимой задачи, если задача, к которой
+// она привязана, выполнена в день done.
+func dependentDate(repeat string, done time.Time) (string, error) {
+	_, days, modifier, ok := afterRule(repeat)
+	if !ok {
+		return "", fmt.Errorf("правило задачи не зависит от выполнения другой задачи: %s", repeat)
+	}
+	date := time.Date(done.Year(), done.Month(), done.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, days)
+	if modifier.text != "" {
+		var err error
+		// Для даты, отсчитанной от выполнения, "пропустить" значит
+		// взять следующий подходящий день
+		date, err = applyDayModifier(modifier, date, func(after time.Time) (time.Time, error) {
+			return after.AddDate(0, 0, 1), nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return date.Format("20060102"), nil
+}
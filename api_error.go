@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// APIError — ответ API с ошибкой. Все обработчики отвечают ошибками в этом
+// виде: {"error": "сообщение", "code": "not_found", "status": 404}; тот же
+// статус — у самого HTTP-ответа. У ошибок правила повторения есть ещё
+// ошибочный фрагмент и его позиция.
+type APIError struct {
+	Message  string `json:"error"`
+	Code     string `json:"code"`
+	Status   int    `json:"status"`
+	Token    string `json:"token,omitempty"`
+	Position *int   `json:"position,omitempty"`
+}
+
+// Коды ошибок, не связанных с правилом повторения; определяются по
+// HTTP-статусу.
+const (
+	errCodeBadRequest       = "bad_request"
+	errCodeNotFound         = "not_found"
+	errCodeMethodNotAllowed = "method_not_allowed"
+	errCodeInternal         = "internal"
+)
+
+// statusErrorCode возвращает код ошибки для HTTP-статуса.
+func statusErrorCode(status int) string {
+	switch status {
+	case http.StatusNotFound:
+		return errCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return errCodeMethodNotAllowed
+	case http.StatusConflict:
+		return errCodeConflict
+	case http.StatusInternalServerError:
+		return errCodeInternal
+	}
+	return errCodeBadRequest
+}
+
+// writeError отвечает ошибкой со статусом status и сообщением message.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, APIError{Message: message, Code: statusErrorCode(status), Status: status})
+}
+
+func writeAPIError(w http.ResponseWriter, e APIError) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(e)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// maxCalendarDays ограничивает длину окна календаря.
+const maxCalendarDays = 366
+
+// CalendarDay — день календаря со всеми задачами, которые на него выпадают.
+type CalendarDay struct {
+	Date  string `json:"date"`
+	Tasks []Task `json:"tasks"`
+}
+
+// taskOccurrences возвращает даты задачи в промежутке [from, to]: её
+// текущую дату, если она не отменена, и следующие повторения, посчитанные
+// так же, как при отметке задачи выполненной. Следующая дата интервального
+// повторения зависит от оценки выполнения, поэтому у такой задачи есть
+// только текущая.
+func taskOccurrences(task Task, from, to time.Time, exdates []string) []string {
+	fromStr, toStr := from.Format("20060102"), to.Format("20060102")
+	opts := RepeatOptions{Exdates: exdates, Overflow: task.Overflow, Start: task.Start}
+	repeating := task.Repeat != "" && !isSpacedRule(task.Repeat)
+
+	date := task.Date
+	if date < fromStr {
+		if !repeating {
+			return nil
+		}
+		// Первое повторение не раньше from
+		next, err := NextDateWith(from.AddDate(0, 0, -1), date, task.Repeat, opts)
+		if err != nil {
+			return nil
+		}
+		date = next
+	}
+	if date > toStr {
+		return nil
+	}
+
+	var dates []string
+	// Отменённая текущая дата не показывается, следующие повторения — да
+	excluded := false
+	for _, exdate := range exdates {
+		excluded = excluded || exdate == date
+	}
+	if !excluded {
+		dates = append(dates, date)
+	}
+	if !repeating {
+		return dates
+	}
+	for {
+		next, err := NextDateWith(from, date, task.Repeat, opts)
+		if err != nil || next > toStr {
+			return dates
+		}
+		dates = append(dates, next)
+		date = next
+	}
+}
+
+// calendarHandler обслуживает /api/calendar?from=20060102&to=20060102:
+// раскрывает правила повторения всех задач в промежутке и группирует
+// повторения по дням.
+func calendarHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Метод не разрешен")
+		return
+	}
+	from, err := time.Parse("20060102", r.URL.Query().Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Некорректная дата from")
+		return
+	}
+	to, err := time.Parse("20060102", r.URL.Query().Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Некорректная дата to")
+		return
+	}
+	if to.Before(from) || daysBetween(from, to) >= maxCalendarDays {
+		writeError(w, http.StatusBadRequest, "Промежуток должен быть не длиннее года, from не позже to")
+		return
+	}
+
+	toStr := to.Format("20060102")
+	tasks, err := getTasksUntilFromDB(db, toStr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	exdates, err := getAllExdatesFromDB(db, toStr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	byDate := make(map[string][]Task)
+	for _, task := range tasks {
+		if task.Repeat != "" {
+			task.RepeatText, _ = DescribeRepeat(task.Repeat)
+		}
+		for _, date := range taskOccurrences(task, from, to, exdates[task.ID]) {
+			occurrence := task
+			occurrence.Date = date
+			byDate[date] = append(byDate[date], occurrence)
+		}
+	}
+
+	days := make([]CalendarDay, 0, len(byDate))
+	for date, dayTasks := range byDate {
+		// Внутри дня задачи упорядочены по времени, задачи без времени — первыми
+		sort.SliceStable(dayTasks, func(i, j int) bool {
+			return dayTasks[i].Time < dayTasks[j].Time
+		})
+		days = append(days, CalendarDay{Date: date, Tasks: dayTasks})
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Date < days[j].Date
+	})
+	json.NewEncoder(w).Encode(map[string]any{"days": days})
+}
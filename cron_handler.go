@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronRule — правило "cron <минуты> <часы> <день месяца> <месяц> <день недели>"
+// в стандартном синтаксисе crontab: списки через запятую, диапазоны "1-5",
+// шаги "*/15", названия месяцев и дней недели (JAN, MON).
+type cronRule struct {
+	minutes  [60]bool
+	hours    [24]bool
+	days     [32]bool
+	months   [13]bool
+	weekdays [7]bool // по индексу time.Weekday
+	// Поле дня месяца или дня недели начинается с "*" (в том числе "*/2"):
+	// по правилам cron тогда должны совпасть оба поля, иначе любое из них
+	anyDay, anyWeekday bool
+}
+
+// cronField описывает одно поле выражения cron.
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var cronFields = [5]cronField{
+	{name: "минуты", min: 0, max: 59},
+	{name: "часы", min: 0, max: 23},
+	{name: "день месяца", min: 1, max: 31},
+	{name: "месяц", min: 1, max: 12, names: map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}},
+	// 0 и 7 — воскресенье
+	{name: "день недели", min: 0, max: 7, names: map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}},
+}
+
+// parseCron разбирает части правила после слова "cron". Ошибка указывает
+// на неверное поле или его элемент.
+func parseCron(repeat string, fields []ruleToken) (*cronRule, error) {
+	if len(fields) < 6 {
+		return nil, newRepeatError(errCodeInvalidFormat, ruleToken{pos: len(repeat)},
+			"в правиле cron должно быть 5 полей, указано %d", len(fields)-1)
+	}
+	if len(fields) > 6 {
+		return nil, newRepeatError(errCodeInvalidFormat, fields[6],
+			"лишнее поле в правиле cron: %s", fields[6].text)
+	}
+
+	c := &cronRule{}
+	for i, field := range fields[1:] {
+		values, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		for v := range values {
+			switch i {
+			case 0:
+				c.minutes[v] = true
+			case 1:
+				c.hours[v] = true
+			case 2:
+				c.days[v] = true
+			case 3:
+				c.months[v] = true
+			case 4:
+				c.weekdays[v%7] = true
+			}
+		}
+	}
+	c.anyDay = strings.HasPrefix(fields[3].text, "*")
+	c.anyWeekday = strings.HasPrefix(fields[5].text, "*")
+	return c, nil
+}
+
+// parseCronField разбирает поле cron в набор значений.
+func parseCronField(field ruleToken, spec cronField) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, item := range field.split(",") {
+		rangeText, stepText, hasStep := strings.Cut(item.text, "/")
+		first, last := spec.min, spec.max
+		if spec.name == "день недели" {
+			last = 6
+		}
+		switch {
+		case rangeText == "*":
+		case strings.Contains(rangeText, "-"):
+			fromText, toText, _ := strings.Cut(rangeText, "-")
+			var err error
+			if first, err = cronValue(fromText, spec); err != nil {
+				return nil, cronFieldError(item, spec)
+			}
+			if last, err = cronValue(toText, spec); err != nil || last < first {
+				return nil, cronFieldError(item, spec)
+			}
+		default:
+			value, err := cronValue(rangeText, spec)
+			if err != nil {
+				return nil, cronFieldError(item, spec)
+			}
+			first = value
+			// "5/15" — с 5 до конца диапазона с шагом 15
+			if !hasStep {
+				last = value
+			}
+		}
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepText)
+			if err != nil || step < 1 || step > spec.max {
+				return nil, newRepeatError(errCodeInvalidValue, item,
+					"некорректный шаг в поле cron «%s»: %s", spec.name, item.text)
+			}
+		}
+		for v := first; v <= last; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+func cronValue(text string, spec cronField) (int, error) {
+	if value, ok := spec.names[strings.ToUpper(text)]; ok {
+		return value, nil
+	}
+	value, err := strconv.Atoi(text)
+	if err != nil || value < spec.min || value > spec.max {
+		return 0, strconv.ErrRange
+	}
+	return value, nil
+}
+
+func cronFieldError(item ruleToken, spec cronField) error {
+	return newRepeatError(errCodeInvalidValue, item,
+		"некорректное значение в поле cron «%s»: %s (допустимо от %d до %d)",
+		spec.name, item.text, spec.min, spec.max)
+}
+
+// matchDay проверяет, есть ли в дне date повторения. Если ограничены и день
+// месяца, и день недели ("0 0 13 * 5"), достаточно совпадения любого из них.
+func (c *cronRule) matchDay(date time.Time) bool {
+	if !c.months[date.Month()] {
+		return false
+	}
+	dayOK, weekdayOK := c.days[date.Day()], c.weekdays[date.Weekday()]
+	if c.anyDay || c.anyWeekday {
+		return dayOK && weekdayOK
+	}
+	return dayOK || weekdayOK
+}
+
+// nextClock возвращает первое время суток из правила строго позже clock
+// ("15:04"); пустой clock — самое раннее время. ok == false, если в этот
+// день больше повторений нет.
+func (c *cronRule) nextClock(clock string) (string, bool) {
+	after := -1
+	if clock != "" {
+		t, err := time.Parse("15:04", clock)
+		if err != nil {
+			return "", false
+		}
+		after = t.Hour()*60 + t.Minute()
+	}
+	for h := 0; h < 24; h++ {
+		if !c.hours[h] {
+			continue
+		}
+		for m := 0; m < 60; m++ {
+			if c.minutes[m] && h*60+m > after {
+				return fmt.Sprintf("%02d:%02d", h, m), true
+			}
+		}
+	}
+	return "", false
+}
+
+// cronExpression возвращает выражение cron из правила, если это правило cron.
+func cronExpression(repeat string) (*cronRule, bool) {
+	fields := ruleFields(repeat)
+	if n := len(fields); n > 0 && isDayModifier(fields[n-1].text) {
+		fields = fields[:n-1]
+	}
+	if len(fields) == 0 || fields[0].text != "cron" {
+		return nil, false
+	}
+	rule, err := parseCron(repeat, fields)
+	return rule, err == nil
+}
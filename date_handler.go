@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -9,41 +10,615 @@ import (
 )
 
 func NextDate(now time.Time, date string, repeat string) (string, error) {
+	return NextDateWith(now, date, repeat, RepeatOptions{})
+}
+
+// RepeatOptions — настройки задачи, влияющие на расчёт повторений.
+type RepeatOptions struct {
+	// Даты-исключения в формате 20060102: отменённое повторение не
+	// становится следующей датой задачи
+	Exdates []string
+	// Что делать с днём, которого нет в месяце; пустая строка — поведение
+	// правила по умолчанию
+	Overflow string
+	// Оценки качества повторений (0..5) от первой к последней; нужны
+	// только правилу "sr"
+	Grades []int
+	// Первая дата серии повторений в формате 20060102 (DTSTART): от неё
+	// правило RRULE считает COUNT, а правила y и RRULE без BYMONTHDAY
+	// берут день месяца. Дата задачи с каждым выполнением меняется (31
+	// января с политикой clamp становится 29 февраля), а начало серии —
+	// нет. Пустая строка — дата задачи
+	Start string
+}
+
+// seriesStart возвращает начало серии повторений задачи с датой date.
+func seriesStart(date time.Time, opts RepeatOptions) time.Time {
+	start, err := time.Parse("20060102", opts.Start)
+	if err != nil || start.After(date) {
+		return date
+	}
+	return start
+}
+
+// NextDateWith работает как NextDate с учётом настроек задачи opts.
+func NextDateWith(now time.Time, date string, repeat string, opts RepeatOptions) (string, error) {
 	// Парсинг входной даты
 	parsedDate, err := time.Parse("20060102", date)
 	if err != nil {
 		return "", err
 	}
 
+	// Следующая дата должна быть строго позже и даты задачи, и дня now.
+	// Время суток в now не учитывается: сравниваются только даты.
+	from := parsedDate
+	if today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC); today.After(from) {
+		from = today
+	}
+
+	fields := ruleFields(repeat)
+	// Модификатор в конце правила ("+b", "!b", "+h", "!h") определяет, что
+	// делать с датой, выпавшей на выходной или праздник
+	var modifier ruleToken
+	if n := len(fields); n > 0 && isDayModifier(fields[n-1].text) {
+		modifier = fields[n-1]
+		repeat = repeat[:fields[n-1].pos]
+		fields = fields[:n-1]
+	}
+	if len(fields) == 0 {
+		return "", &RepeatError{Code: errCodeEmptyRule, Position: 0, Message: "правило повторения не указано"}
+	}
+
+	next := func(after time.Time) (time.Time, error) {
+		nextDate, err := nextOccurrence(parsedDate, after, repeat, fields, opts)
+		if err != nil || modifier.text == "" {
+			return nextDate, err
+		}
+		return applyDayModifier(modifier, nextDate, func(after time.Time) (time.Time, error) {
+			return nextOccurrence(parsedDate, after, repeat, fields, opts)
+		})
+	}
+	nextDate, err := next(from)
+	if err != nil {
+		return "", err
+	}
+
+	excluded := make(map[string]bool, len(opts.Exdates))
+	for _, exdate := range opts.Exdates {
+		excluded[exdate] = true
+	}
+	for skipped := 0; excluded[nextDate.Format("20060102")]; skipped++ {
+		if skipped >= maxDaysOff {
+			return "", newRepeatError(errCodeNoOccurrences, fields[0],
+				"все повторения задачи отменены исключениями")
+		}
+		if nextDate, err = next(nextDate); err != nil {
+			return "", err
+		}
+	}
+
+	return nextDate.Format("20060102"), nil
+}
+
+// nextOccurrence возвращает первое повторение правила строго после from.
+// Правило уже разбито на части, модификатор из него убран.
+func nextOccurrence(parsedDate, from time.Time, repeat string, fields []ruleToken, opts RepeatOptions) (time.Time, error) {
 	var nextDate time.Time
+	// Политика для дней, которых нет в месяце
+	overflow := opts.Overflow
 
 	switch {
-	case strings.HasPrefix(repeat, "d "):
+	case strings.Contains(repeat, "="):
+		// Правило RFC 5545, например "FREQ=WEEKLY;BYDAY=MO,TH"
+		rule, err := parseRRule(repeat)
+		if err != nil {
+			return nextDate, err
+		}
+		rule.overflow = overflow
+		nextDate, err = rule.next(seriesStart(parsedDate, opts), from)
+		if err != nil {
+			return nextDate, err
+		}
+
+	case fields[0].text == "d":
+		if err := checkRuleFields(repeat, fields, 2, 2); err != nil {
+			return nextDate, err
+		}
 		// Извлечение количества дней
-		daysStr := strings.TrimPrefix(repeat, "d ")
-		days, err := strconv.Atoi(daysStr)
+		days, err := strconv.Atoi(fields[1].text)
+		if err != nil || days < 1 || days > 400 {
+			return nextDate, newRepeatError(errCodeInvalidValue, fields[1],
+				"число дней должно быть от 1 до 400: %s", fields[1].text)
+		}
+		// Число целых интервалов от даты задачи до from, плюс один
+		steps := daysBetween(parsedDate, from)/days + 1
+		nextDate = parsedDate.AddDate(0, 0, steps*days)
+
+	case fields[0].text == "y":
+		if err := checkRuleFields(repeat, fields, 1, 1); err != nil {
+			return nextDate, err
+		}
+		// Годы отсчитываются от начала серии, а не от перенесённой даты
+		// задачи, поэтому 29 февраля снова выпадает на 29 февраля в
+		// високосные годы. В остальные годы оно по умолчанию переносится
+		// на 1 марта
+		if overflow == "" {
+			overflow = overflowForward
+		}
+		start := seriesStart(parsedDate, opts)
+		for years := max(from.Year()-start.Year(), 1); ; years++ {
+			date, ok := monthDayDate(start.Year()+years, start.Month(), start.Day(), overflow)
+			if ok && date.After(from) {
+				nextDate = date
+				break
+			}
+		}
+
+	case fields[0].text == "w":
+		if err := checkRuleFields(repeat, fields, 2, 2); err != nil {
+			return nextDate, err
+		}
+		// Разбор списка дней недели: 1 — понедельник, 7 — воскресенье
+		weekdays, err := parseWeekdays(fields[1])
+		if err != nil {
+			return nextDate, err
+		}
+		// Ближайший из выбранных дней недели после from
+		shift := 7
+		for wd, ok := range weekdays {
+			if ok {
+				shift = min(shift, (wd-int(from.Weekday())+6)%7+1)
+			}
+		}
+		nextDate = from.AddDate(0, 0, shift)
+
+	case fields[0].text == "m":
+		// Дни месяца и необязательный список месяцев: "m 1,-1 3,6"
+		if err := checkRuleFields(repeat, fields, 2, 3); err != nil {
+			return nextDate, err
+		}
+		days, err := parseMonthDays(fields[1])
+		if err != nil {
+			return nextDate, err
+		}
+		months, err := parseMonths(fields[2:])
+		if err != nil {
+			return nextDate, err
+		}
+		// По умолчанию месяцы без нужного дня пропускаются
+		if overflow == "" {
+			overflow = overflowSkip
+		}
+		nextDate, err = nextMonthDay(from, months, days, overflow)
+		if err != nil {
+			return nextDate, newRepeatError(errCodeNoOccurrences, fields[1], "%v", err)
+		}
+
+	case fields[0].text == "n":
+		// N-й день недели месяца: "n 2:2" — второй вторник, "n -1:5 3" —
+		// последняя пятница марта
+		if err := checkRuleFields(repeat, fields, 2, 3); err != nil {
+			return nextDate, err
+		}
+		weekdays, err := parseNthWeekdays(fields[1])
+		if err != nil {
+			return nextDate, err
+		}
+		months, err := parseMonths(fields[2:])
+		if err != nil {
+			return nextDate, err
+		}
+		nextDate, err = nextInMonths(from, months, func(date time.Time) bool {
+			first := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+			last := time.Date(date.Year(), date.Month(), lastDayOfMonth(date.Year(), date.Month()), 0, 0, 0, 0, time.UTC)
+			for _, wn := range weekdays {
+				if wn.matches(date, first, last) {
+					return true
+				}
+			}
+			return false
+		})
+		if err != nil {
+			return nextDate, newRepeatError(errCodeNoOccurrences, fields[1], "%v", err)
+		}
+
+	case fields[0].text == "b":
+		if err := checkRuleFields(repeat, fields, 2, 2); err != nil {
+			return nextDate, err
+		}
+		// Каждые N рабочих дней, считая от даты задачи
+		days, err := strconv.Atoi(fields[1].text)
 		if err != nil || days < 1 || days > 400 {
-			return "", fmt.Errorf("22222")
+			return nextDate, newRepeatError(errCodeInvalidValue, fields[1],
+				"число рабочих дней должно быть от 1 до 400: %s", fields[1].text)
+		}
+		nextDate, err = nextWorkdayStep(parsedDate, from, days)
+		if err != nil {
+			return nextDate, newRepeatError(errCodeNoOccurrences, fields[0], "%v", err)
+		}
+
+	case fields[0].text == "cron":
+		// Выражение cron: "cron 0 9 * * 1-5". Здесь повторения считаются с
+		// точностью до дня, время учитывает nextTaskDate
+		rule, err := parseCron(repeat, fields)
+		if err != nil {
+			return nextDate, err
+		}
+		nextDate, err = nextInMonths(from, rule.months, rule.matchDay)
+		if err != nil {
+			return nextDate, newRepeatError(errCodeNoOccurrences, fields[3], "по правилу cron нет ни одного дня")
 		}
-		nextDate = parsedDate.AddDate(0, 0, days)
 
-	case repeat == "y":
-		nextDate = parsedDate.AddDate(1, 0, 0)
+	case fields[0].text == "sr":
+		// Интервальное повторение: интервал считается по оценкам
+		// выполнения задачи от дня выполнения
+		ease, err := parseSpacedRule(repeat, fields)
+		if err != nil {
+			return nextDate, err
+		}
+		interval, _ := spacedInterval(ease, opts.Grades)
+		nextDate = from.AddDate(0, 0, interval)
+
+	case fields[0].text == "after":
+		// Дата зависимой задачи назначается при выполнении другой задачи,
+		// сама по себе она не повторяется
+		trigger, _, err := parseAfterRule(repeat, fields)
+		if err != nil {
+			return nextDate, err
+		}
+		return nextDate, newRepeatError(errCodeNoOccurrences, fields[1],
+			"дата задачи появится после выполнения задачи %d", trigger)
 
 	default:
-		return "", fmt.Errorf("3333")
+		return nextDate, newRepeatError(errCodeUnknownRule, fields[0],
+			"неизвестный тип правила повторения: %s", fields[0].text)
 	}
 
-	// Если следующая дата меньше или равна now, добавляем необходимое количество повторений
-	for nextDate.Before(now) {
-		if repeat == "y" {
-			nextDate = nextDate.AddDate(1, 0, 0)
-		} else {
-			nextDate = nextDate.AddDate(0, 0, 400) // Максимальное значение
+	return nextDate, nil
+}
+
+// Якорь повторения задачи.
+const (
+	anchorSchedule   = "schedule"
+	anchorCompletion = "completion"
+)
+
+// Политика для пропущенных повторений просроченной задачи с якорем schedule.
+const (
+	catchupSkip = "skip" // сразу перейти к ближайшему будущему повторению
+	catchupOne  = "one"  // каждое выполнение закрывает одно пропущенное повторение
+	catchupEach = "each" // как one, но в списке каждое пропущенное повторение — отдельная запись
+)
+
+// isCatchupPolicy проверяет значение настройки catchup задачи.
+func isCatchupPolicy(catchup string) bool {
+	switch catchup {
+	case "", catchupSkip, catchupOne, catchupEach:
+		return true
+	}
+	return false
+}
+
+// catchesUp сообщает, что выполнение задачи закрывает только одно
+// пропущенное повторение, а не переносит её сразу в будущее.
+func catchesUp(task Task) bool {
+	return (task.Catchup == catchupOne || task.Catchup == catchupEach) &&
+		task.Anchor != anchorCompletion && !isSpacedRule(task.Repeat)
+}
+
+// maxOverdueEntries ограничивает число записей о пропущенных повторениях
+// одной задачи в списке.
+const maxOverdueEntries = 100
+
+// overdueDates возвращает даты, под которыми задача показывается в списке
+// на день now: для политики each — её дату и все пропущенные с неё
+// повторения до сегодняшнего дня, иначе — только её дату.
+func overdueDates(now time.Time, task Task, exdates []string) []string {
+	today := now.Format("20060102")
+	dates := []string{task.Date}
+	if task.Catchup != catchupEach || !catchesUp(task) || task.Repeat == "" {
+		return dates
+	}
+	opts := RepeatOptions{Exdates: exdates, Overflow: task.Overflow, Start: task.Start}
+	for date := task.Date; len(dates) < maxOverdueEntries; {
+		parsed, err := time.Parse("20060102", date)
+		if err != nil {
+			break
+		}
+		next, err := NextDateWith(parsed, date, task.Repeat, opts)
+		if err != nil || next > today {
+			break
 		}
+		dates = append(dates, next)
+		date = next
 	}
+	return dates
+}
 
-	return nextDate.Format("20060102"), nil
+// nextTaskDate возвращает дату и время, на которые переносится
+// повторяющаяся задача, выполненная в момент now (в поясе задачи). С якорем
+// completion правило отсчитывается от дня выполнения, а не от даты задачи:
+// "полить цветы через 3 дня после того, как полил". Правило cron у задачи со
+// временем повторяется с точностью до минуты, поэтому следующим может
+// оказаться более позднее время того же дня. Правило sr всегда
+// отсчитывается от дня выполнения; в opts передаются исключения задачи и
+// оценки её выполнения вместе с текущей. Задача с правилом after после
+// выполнения остаётся без даты. Политика catchup задачи определяет, сколько
+// пропущенных повторений закрывает одно выполнение.
+func nextTaskDate(now time.Time, task Task, opts RepeatOptions) (string, string, error) {
+	// Просроченная задача, закрывающая пропуски по одному, переносится
+	// на первое повторение после своей даты, даже если оно тоже в прошлом
+	if catchesUp(task) && task.Date < now.Format("20060102") {
+		if parsed, err := time.ParseInLocation("20060102", task.Date, now.Location()); err == nil {
+			now = parsed
+		}
+	}
+	today, nowClock := now.Format("20060102"), now.Format("15:04")
+	date, clock := task.Date, task.Time
+	opts.Overflow, opts.Start = task.Overflow, task.Start
+	if task.Anchor == anchorCompletion || isSpacedRule(task.Repeat) {
+		// Серия начинается заново с каждого выполнения
+		date, clock = today, nowClock
+		opts.Start = ""
+	}
+	// Зависимая задача снова ждёт выполнения задачи, к которой привязана
+	if _, _, _, ok := afterRule(task.Repeat); ok {
+		return "", task.Time, nil
+	}
+
+	cron, isCron := cronExpression(task.Repeat)
+	if !isCron || task.Time == "" {
+		nextDate, err := NextDateWith(now, date, task.Repeat, opts)
+		return nextDate, task.Time, err
+	}
+	if date >= today {
+		if date == today && nowClock > clock {
+			clock = nowClock
+		}
+		if next, ok := cron.nextClock(clock); ok {
+			return date, next, nil
+		}
+	}
+	nextDate, err := NextDateWith(now, date, task.Repeat, opts)
+	first, _ := cron.nextClock("")
+	return nextDate, first, err
+}
+
+// maxNextDates ограничивает число дат, которое можно получить за один запрос.
+const maxNextDates = 100
+
+// NextDates возвращает ближайшие повторения задачи: не больше count (0 — без
+// ограничения, но не больше maxNextDates) и не позже until, если она задана.
+// Настройки задачи opts учитываются так же, как в NextDateWith.
+// Каждая следующая дата считается через NextDate от предыдущей, как при
+// отметке задачи выполненной, поэтому предпросмотр совпадает с тем, как
+// задача будет переноситься на самом деле. Серия повторений начинается с
+// date, если в opts не указано другое начало.
+func NextDates(now time.Time, date string, repeat string, count int, until string, opts RepeatOptions) ([]string, error) {
+	if count <= 0 || count > maxNextDates {
+		count = maxNextDates
+	}
+	if opts.Start == "" {
+		opts.Start = date
+	}
+	if until != "" {
+		if _, err := time.Parse("20060102", until); err != nil {
+			return nil, fmt.Errorf("некорректная дата until: %v", err)
+		}
+	}
+
+	dates := make([]string, 0, count)
+	for len(dates) < count {
+		nextDate, err := NextDateWith(now, date, repeat, opts)
+		if err != nil {
+			// Правило уже проверено первой датой, значит повторения закончились
+			if len(dates) > 0 {
+				break
+			}
+			return nil, err
+		}
+		if until != "" && nextDate > until {
+			break
+		}
+		dates = append(dates, nextDate)
+		date = nextDate
+	}
+	return dates, nil
+}
+
+// checkRuleFields проверяет, что в правиле от min до max частей, и указывает
+// на лишнюю часть или на конец строки, если части не хватает.
+func checkRuleFields(repeat string, fields []ruleToken, min, max int) error {
+	if len(fields) < min {
+		return newRepeatError(errCodeInvalidFormat, ruleToken{pos: len(repeat)},
+			"в правиле '%s' не хватает значения", fields[0].text)
+	}
+	if len(fields) > max {
+		return newRepeatError(errCodeInvalidFormat, fields[max],
+			"лишняя часть в правиле '%s': %s", fields[0].text, fields[max].text)
+	}
+	return nil
+}
+
+// parseWeekdays разбирает список вида "1,4,7" в набор дней недели.
+func parseWeekdays(list ruleToken) ([7]bool, error) {
+	var weekdays [7]bool
+	for _, wd := range list.split(",") {
+		wdNum, err := strconv.Atoi(wd.text)
+		if err != nil || wdNum < 1 || wdNum > 7 {
+			return weekdays, newRepeatError(errCodeInvalidValue, wd,
+				"некорректный номер дня недели: %s", wd.text)
+		}
+		// В time.Weekday воскресенье — 0
+		weekdays[wdNum%7] = true
+	}
+	return weekdays, nil
+}
+
+// parseNthWeekdays разбирает список вида "2:2,-1:5": порядковый номер дня
+// недели в месяце (1..5 или -1..-5, с конца) и день недели (1..7).
+func parseNthWeekdays(list ruleToken) ([]weekdayNum, error) {
+	var weekdays []weekdayNum
+	for _, item := range list.split(",") {
+		ordStr, wdStr, ok := strings.Cut(item.text, ":")
+		if !ok {
+			return nil, newRepeatError(errCodeInvalidFormat, item,
+				"ожидается номер и день недели через двоеточие: %s", item.text)
+		}
+		ord, err := strconv.Atoi(ordStr)
+		if err != nil || ord == 0 || ord < -5 || ord > 5 {
+			return nil, newRepeatError(errCodeInvalidValue, ruleToken{ordStr, item.pos},
+				"некорректный порядковый номер дня недели: %s", ordStr)
+		}
+		wdNum, err := strconv.Atoi(wdStr)
+		if err != nil || wdNum < 1 || wdNum > 7 {
+			return nil, newRepeatError(errCodeInvalidValue, ruleToken{wdStr, item.pos + len(ordStr) + 1},
+				"некорректный номер дня недели: %s", wdStr)
+		}
+		weekdays = append(weekdays, weekdayNum{ord: ord, weekday: time.Weekday(wdNum % 7), tok: item})
+	}
+	return weekdays, nil
+}
+
+// parseMonthDays разбирает список дней месяца: 1..31, -1 — последний день,
+// -2 — предпоследний.
+func parseMonthDays(list ruleToken) ([]int, error) {
+	days := make([]int, 0)
+	for _, dayTok := range list.split(",") {
+		day, err := strconv.Atoi(dayTok.text)
+		if err != nil || day == 0 || day < -2 || day > 31 {
+			return nil, newRepeatError(errCodeInvalidValue, dayTok,
+				"некорректный день месяца: %s", dayTok.text)
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// parseMonths разбирает необязательный список месяцев; пустой список
+// означает все месяцы.
+func parseMonths(fields []ruleToken) ([13]bool, error) {
+	var months [13]bool
+	if len(fields) == 0 {
+		for m := 1; m <= 12; m++ {
+			months[m] = true
+		}
+		return months, nil
+	}
+	for _, monthTok := range fields[0].split(",") {
+		monthNum, err := strconv.Atoi(monthTok.text)
+		if err != nil || monthNum < 1 || monthNum > 12 {
+			return months, newRepeatError(errCodeInvalidValue, monthTok,
+				"некорректный номер месяца: %s", monthTok.text)
+		}
+		months[monthNum] = true
+	}
+	return months, nil
+}
+
+// nextInMonths ищет первый день строго после from в одном из месяцев months,
+// подходящий под match. Месяцы, в которых нужного дня нет (31 апреля,
+// пятый понедельник), пропускаются.
+func nextInMonths(from time.Time, months [13]bool, match func(time.Time) bool) (time.Time, error) {
+	year, month := from.Year(), from.Month()
+	// 29 февраля может не встречаться до 8 лет подряд, а пятый четверг
+	// февраля — почти 30 лет
+	for i := 0; i < 12*40; i++ {
+		if months[month] {
+			lastDay := lastDayOfMonth(year, month)
+			for day := 1; day <= lastDay; day++ {
+				date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+				if date.After(from) && match(date) {
+					return date, nil
+				}
+			}
+		}
+		month++
+		if month > time.December {
+			month = time.January
+			year++
+		}
+	}
+	return time.Time{}, fmt.Errorf("не удалось найти подходящий день месяца")
+}
+
+// Что делать с повторением, дня которого нет в месяце (29 февраля в
+// невисокосный год, 31 апреля).
+const (
+	overflowForward = "forward" // перенести на 1-е число следующего месяца
+	overflowClamp   = "clamp"   // перенести на последний день месяца
+	overflowSkip    = "skip"    // пропустить месяц или год
+)
+
+// isOverflowPolicy проверяет значение настройки overflow задачи.
+func isOverflowPolicy(overflow string) bool {
+	switch overflow {
+	case "", overflowForward, overflowClamp, overflowSkip:
+		return true
+	}
+	return false
+}
+
+// monthDayDate возвращает день day месяца (-1 — последний, -2 —
+// предпоследний) с учётом политики overflow; ok == false, если повторение
+// в этом месяце пропускается.
+func monthDayDate(year int, month time.Month, day int, overflow string) (time.Time, bool) {
+	lastDay := lastDayOfMonth(year, month)
+	switch {
+	case day < 0:
+		day = lastDay + 1 + day
+	case day > lastDay:
+		switch overflow {
+		case overflowClamp:
+			day = lastDay
+		case overflowForward:
+			day = lastDay + 1
+		default:
+			return time.Time{}, false
+		}
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC), true
+}
+
+// nextMonthDay ищет ближайший после from из дней месяца days в месяцах
+// months. Перенесённое повторение относится к месяцу, в котором должно
+// было быть.
+func nextMonthDay(from time.Time, months [13]bool, days []int, overflow string) (time.Time, error) {
+	// Перенесённое вперёд повторение прошлого месяца может выпасть на месяц from
+	year, month := from.Year(), from.Month()-1
+	if month < time.January {
+		year, month = year-1, time.December
+	}
+	// 29 февраля может не встречаться до 8 лет подряд
+	for i := 0; i < 12*40; i++ {
+		if months[month] {
+			var next time.Time
+			for _, day := range days {
+				date, ok := monthDayDate(year, month, day, overflow)
+				if ok && date.After(from) && (next.IsZero() || date.Before(next)) {
+					next = date
+				}
+			}
+			if !next.IsZero() {
+				return next, nil
+			}
+		}
+		month++
+		if month > time.December {
+			month = time.January
+			year++
+		}
+	}
+	return time.Time{}, fmt.Errorf("не удалось найти подходящий день месяца")
+}
+
+// daysBetween возвращает число дней от from до to; обе даты — полночь UTC.
+func daysBetween(from, to time.Time) int {
+	return int(to.Sub(from).Hours() / 24)
+}
+
+func lastDayOfMonth(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
 }
 
 func nextDateHandler(w http.ResponseWriter, r *http.Request) {
@@ -53,206 +628,107 @@ func nextDateHandler(w http.ResponseWriter, r *http.Request) {
 	repeat := query.Get("repeat")
 
 	if now == "" || date == "" {
-		http.Error(w, "Не указаны параметры now или date", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Не указаны параметры now или date")
+		return
 	}
 	_now, err := time.Parse("20060102", now)
 	if err != nil {
-		http.Error(w, "Неверный формат даты", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Некорректный формат даты now")
+		return
+	}
+	if _, err := time.Parse("20060102", date); err != nil {
+		writeError(w, http.StatusBadRequest, "Некорректный формат даты date")
+		return
+	}
+
+	// Даты-исключения передаются параметром exdate через запятую
+	// или несколькими параметрами
+	var exdates []string
+	for _, list := range query["exdate"] {
+		for _, exdate := range strings.Split(list, ",") {
+			if _, err := time.Parse("20060102", exdate); err != nil {
+				writeError(w, http.StatusBadRequest, "Некорректная дата в параметре exdate")
+				return
+			}
+			exdates = append(exdates, exdate)
+		}
+	}
+
+	opts := RepeatOptions{Exdates: exdates, Overflow: query.Get("overflow")}
+	if !isOverflowPolicy(opts.Overflow) {
+		writeError(w, http.StatusBadRequest, "Параметр overflow должен быть forward, clamp или skip")
+		return
+	}
+	// Оценки выполнения для правила sr: grades=5,4,3
+	if list := query.Get("grades"); list != "" {
+		grades, ok := parseGrades(list)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Параметр grades должен быть списком оценок от 0 до 5")
+			return
+		}
+		opts.Grades = grades
+	}
+
+	// С параметрами count или until возвращается JSON-массив дат
+	countStr := query.Get("count")
+	until := query.Get("until")
+	if countStr != "" || until != "" {
+		count := 0
+		if countStr != "" {
+			count, err = strconv.Atoi(countStr)
+			if err != nil || count < 1 || count > maxNextDates {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("Параметр count должен быть от 1 до %d", maxNextDates))
+				return
+			}
+		}
+		dates, err := NextDates(_now, date, repeat, count, until, opts)
+		if err != nil {
+			writeRepeatError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		json.NewEncoder(w).Encode(dates)
+		return
 	}
 
-	nextDate, err := NextDate(_now, date, repeat)
+	nextDate, err := NextDateWith(_now, date, repeat, opts)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeRepeatError(w, err)
+		return
 	}
 
 	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
 	fmt.Fprintf(w, nextDate)
 }
 
-func isDateValid(dateString string) (bool, error) {
+// serverLocation — часовой пояс сервера, задаётся переменной TODO_TZ.
+var serverLocation = time.Local
+
+// taskLocation возвращает часовой пояс задачи, а если он не указан — пояс
+// сервера.
+func taskLocation(tz string) (*time.Location, error) {
+	if tz == "" {
+		return serverLocation, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("Некорректный часовой пояс: %s", tz)
+	}
+	return loc, nil
+}
+
+// isDateValid проверяет, что дата не раньше сегодняшнего дня в поясе loc.
+func isDateValid(dateString string, loc *time.Location) (bool, error) {
 	layout := "20060102"
 	taskDate, err := time.Parse(layout, dateString)
 	if err != nil {
 		return false, fmt.Errorf("Некорректный формат даты: %v", err)
 	}
-	now := time.Now().Format(layout)
+	now := time.Now().In(loc).Format(layout)
 	currentDate, err := time.Parse(layout, now)
 	if err != nil {
 		return false, fmt.Errorf("Ошибка при определении текущей даты: %v", err)
 	}
 	return !taskDate.Before(currentDate), nil
 }
-
-// func NextDate(now time.Time, date string, repeat string) (string, error) {
-// 	layout := "20060102"
-// 	taskDate, err := time.Parse(layout, date)
-
-// 	if err != nil {
-// 		return "", fmt.Errorf("Ошибка парсинга даты: %v", err)
-// 	}
-// 	repeat = strings.TrimSpace(repeat)
-// 	if repeat == "" {
-// 		return "", nil
-// 	}
-
-// 	var nextDate time.Time
-
-// 	switch {
-// 	// Повторение ежегодно
-// 	case repeat == "y":
-// 		nextDate = taskDate
-// 		for nextDate.Year() <= now.Year() {
-// 			nextDate = nextDate.AddDate(1, 0, 0)
-// 			if nextDate.Year() > now.Year()+100 {
-// 				return "", fmt.Errorf("превышен лимит повторений по годам")
-// 			}
-// 		}
-// 	// Повторение каждые N дней
-// 	case strings.HasPrefix(repeat, "d "):
-
-// 		fields := strings.Fields(repeat)
-// 		if len(fields) != 2 {
-// 			return "", fmt.Errorf("некорректный формат правила 'd N'")
-// 		}
-// 		days, err := strconv.Atoi(fields[1])
-// 		if err != nil || days <= 0 || days > 400 {
-// 			return "", fmt.Errorf("некорректное число дней в правиле повторения")
-// 		}
-// 		nextDate = taskDate
-// 		for !nextDate.After(now) {
-// 			nextDate = nextDate.AddDate(0, 0, days)
-// 			if nextDate.After(taskDate.AddDate(5, 0, 0)) {
-// 				return "", fmt.Errorf("превышен лимит повторений по дням")
-// 			}
-// 		}
-// 	// Повторение по дням недели
-// 	case strings.HasPrefix(repeat, "w "):
-// 		fields := strings.Fields(repeat)
-// 		if len(fields) != 2 {
-// 			return "", fmt.Errorf("некорректный формат правила 'w'")
-// 		}
-// 		weekdaysStr := strings.Split(fields[1], ",")
-// 		weekdays := make([]time.Weekday, 0, len(weekdaysStr))
-// 		for _, wdStr := range weekdaysStr {
-// 			wdStr = strings.TrimSpace(wdStr)
-// 			wdNum, err := strconv.Atoi(wdStr)
-// 			if err != nil || wdNum < 1 || wdNum > 7 {
-// 				return "", fmt.Errorf("некорректный номер дня недели: %s", wdStr)
-// 			}
-// 			var wd time.Weekday
-// 			if wdNum == 7 {
-// 				wd = time.Sunday
-// 			} else {
-// 				wd = time.Weekday(wdNum)
-// 			}
-// 			weekdays = append(weekdays, wd)
-// 		}
-// 		nextDate = now.AddDate(0, 0, 1)
-// 		found := false
-// 		for i := 0; i < 14; i++ {
-// 			for _, wd := range weekdays {
-// 				if nextDate.Weekday() == wd {
-// 					if nextDate.After(now) {
-// 						found = true
-// 						break
-// 					}
-// 				}
-// 			}
-// 			if found {
-// 				break
-// 			}
-// 			nextDate = nextDate.AddDate(0, 0, 1)
-// 		}
-// 		if !found {
-// 			return "", fmt.Errorf("не удалось найти подходящий день недели")
-// 		}
-// 	// Повторение по дням месяца
-// 	case strings.HasPrefix(repeat, "m "):
-// 		fields := strings.Fields(repeat)
-// 		if len(fields) < 2 || len(fields) > 3 {
-// 			return "", fmt.Errorf("некорректный формат правила 'm'")
-// 		}
-
-// 		daysStr := strings.Split(fields[1], ",")
-// 		daysOfMonth := make([]int, 0, len(daysStr))
-// 		for _, dayStr := range daysStr {
-// 			dayStr = strings.TrimSpace(dayStr)
-// 			day, err := strconv.Atoi(dayStr)
-// 			if err != nil || (day == 0) || (day < -2) || day > 31 {
-// 				return "", fmt.Errorf("некорректный день месяца: %s", dayStr)
-// 			}
-// 			daysOfMonth = append(daysOfMonth, day)
-// 		}
-// 		monthsOfYear := make([]time.Month, 0)
-// 		if len(fields) == 3 {
-// 			monthsStr := strings.Split(fields[2], ",")
-// 			for _, monthStr := range monthsStr {
-// 				monthStr = strings.TrimSpace(monthStr)
-// 				monthNum, err := strconv.Atoi(monthStr)
-// 				if err != nil || monthNum < 1 || monthNum > 12 {
-// 					return "", fmt.Errorf("некорректный номер месяца: %s", monthStr)
-// 				}
-// 				monthsOfYear = append(monthsOfYear, time.Month(monthNum))
-// 			}
-// 		} else {
-// 			for m := time.January; m <= time.December; m++ {
-// 				monthsOfYear = append(monthsOfYear, m)
-// 			}
-// 		}
-// 		nextDate = now.AddDate(0, 0, 1)
-// 		for i := 0; i < 366; i++ {
-// 			if !containsMonth(monthsOfYear, nextDate.Month()) {
-// 				nextDate = nextDate.AddDate(0, 0, 1)
-// 				continue
-// 			}
-// 			if containsDayOfMonth(daysOfMonth, nextDate) && nextDate.After(now) {
-// 				break
-// 			}
-// 			nextDate = nextDate.AddDate(0, 0, 1)
-// 		}
-// 		if !nextDate.After(now) {
-// 			return "", fmt.Errorf("не удалось найти подходящий день месяца")
-// 		}
-// 	default:
-// 		return "", nil
-// 	}
-
-// 	return nextDate.Format(layout), nil
-// }
-
-// func containsMonth(months []time.Month, month time.Month) bool {
-// 	for _, m := range months {
-// 		if m == month {
-// 			return true
-// 		}
-// 	}
-// 	return false
-// }
-
-// func containsDayOfMonth(days []int, date time.Time) bool {
-//     day := date.Day()
-//     lastDay := lastDayOfMonth(date.Year(), date.Month())
-//     for _, d := range days {
-//         switch {
-//         case d > 0 && d == day:
-//             return true
-//         case d == -1 && day == lastDay:
-//             return true
-//         case d == -2 && day == lastDay-1:
-//             return true
-//         }
-//     }
-//     return false
-// }
-
-// func lastDayOfMonth(year int, month time.Month) int {
-// 	nextMonth := month + 1
-// 	if nextMonth > 12 {
-// 		nextMonth = 1
-// 		year++
-// 	}
-// 	firstOfNextMonth := time.Date(year, nextMonth, 1, 0, 0, 0, 0, time.UTC)
-// 	lastDay := firstOfNextMonth.AddDate(0, 0, -1)
-// 	return lastDay.Day()
-// }
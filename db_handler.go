@@ -2,9 +2,18 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// maxRepeatLength — наибольшая длина правила повторения, как в CHECK
+// столбца repeat.
+const maxRepeatLength = 128
+
 func createDatabase(db *sql.DB) error {
 
 	createTableSQL := `
@@ -33,15 +42,23 @@ func createDatabase(db *sql.DB) error {
 }
 
 func createTaskInDB(db *sql.DB, task Task) (string, error) {
-	valid, err := isDateValid(task.Date)
+	loc, err := taskLocation(task.TZ)
+	if err != nil {
+		return "", err
+	}
+	// У задачи, ждущей выполнения другой задачи, даты ещё нет
+	valid, err := task.Date == "", nil
+	if !valid {
+		valid, err = isDateValid(task.Date, loc)
+	}
 
 	if !valid {
 		return "", fmt.Errorf("Дата задачи должна быть равна или больше текущей даты.")
 	}
-	query := `INSERT INTO scheduler (date, title, comment, repeat) VALUES (?, ?, ?, ?)`
+	query := `INSERT INTO scheduler (date, title, comment, repeat, time, tz, anchor, overflow, catchup, start)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	fmt.Println(task.Date, task.Title, task.Comment, task.Repeat)
-	result, err := db.Exec(query, task.Date, task.Title, task.Comment, task.Repeat)
+	result, err := db.Exec(query, task.Date, task.Title, task.Comment, task.Repeat, task.Time, task.TZ, task.Anchor, task.Overflow, task.Catchup, task.Start)
 	if err != nil {
 		return "", fmt.Errorf("Ошибка при добавлении задачи в базу данных: %v", err)
 	}
@@ -51,3 +68,556 @@ func createTaskInDB(db *sql.DB, task Task) (string, error) {
 	}
 	return fmt.Sprintf("%d", id), nil
 }
+
+// querier — общее у *sql.DB и *sql.Tx: функции чтения с таким параметром
+// работают и внутри транзакции.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// getTaskFromDB возвращает задачу по id; если её нет — sql.ErrNoRows.
+func getTaskFromDB(db querier, id string) (Task, error) {
+	rows, err := db.Query(`SELECT `+taskColumns+` FROM scheduler WHERE id = ?`, id)
+	if err != nil {
+		return Task{}, fmt.Errorf("Ошибка при чтении задачи: %v", err)
+	}
+	tasks, err := scanTasks(rows)
+	if err != nil {
+		return Task{}, err
+	}
+	if len(tasks) == 0 {
+		return Task{}, sql.ErrNoRows
+	}
+	return tasks[0], nil
+}
+
+// updateTaskInDB заменяет поля задачи и сообщает, была ли такая задача.
+func updateTaskInDB(db *sql.DB, task Task) (bool, error) {
+	query := `UPDATE scheduler SET date = ?, title = ?, comment = ?, repeat = ?, time = ?, tz = ?,
+        anchor = ?, overflow = ?, catchup = ?, start = ? WHERE id = ?`
+	result, err := db.Exec(query, task.Date, task.Title, task.Comment, task.Repeat, task.Time, task.TZ,
+		task.Anchor, task.Overflow, task.Catchup, task.Start, task.ID)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка при изменении задачи: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("Ошибка при изменении задачи: %v", err)
+	}
+	return n > 0, nil
+}
+
+// errTaskAwaited — задачу нельзя удалить, пока её выполнения ждут другие
+// задачи.
+var errTaskAwaited = errors.New("Задачу ждут другие задачи")
+
+// deleteTaskFromDB удаляет задачу вместе с её исключениями и оценками и
+// сообщает, была ли такая задача. Если задачу ещё ждут задачи с правилом
+// after, она не удаляется, а ошибка оборачивает errTaskAwaited.
+func deleteTaskFromDB(db *sql.DB, id string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("Ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	dependents, err := dependentsInTx(tx, id)
+	if err != nil {
+		return false, err
+	}
+	if len(dependents) > 0 {
+		ids := make([]string, 0, len(dependents))
+		for depID := range dependents {
+			ids = append(ids, strconv.FormatInt(depID, 10))
+		}
+		sort.Strings(ids)
+		return false, fmt.Errorf("%w: %s; измените их правило или удалите их", errTaskAwaited, strings.Join(ids, ", "))
+	}
+	deleted, err := deleteTaskInTx(tx, id)
+	if err != nil || !deleted {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("Ошибка при удалении задачи: %v", err)
+	}
+	return true, nil
+}
+
+// deleteTaskInTx удаляет задачу и связанные с ней строки в транзакции tx.
+// Внешние ключи в SQLite по умолчанию выключены, поэтому исключения и
+// оценки удаляются явно. Зависимые задачи не удаляются: у тех, которым
+// дата уже назначена, она остаётся.
+func deleteTaskInTx(tx *sql.Tx, id string) (bool, error) {
+	result, err := tx.Exec(`DELETE FROM scheduler WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка при удалении задачи: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("Ошибка при удалении задачи: %v", err)
+	}
+	if n == 0 {
+		return false, nil
+	}
+	for _, query := range []string{
+		`DELETE FROM exdates WHERE task_id = ?`,
+		`DELETE FROM reviews WHERE task_id = ?`,
+	} {
+		if _, err := tx.Exec(query, id); err != nil {
+			return false, fmt.Errorf("Ошибка при удалении задачи: %v", err)
+		}
+	}
+	return true, nil
+}
+
+// migrateDatabase создаёт таблицы, появившиеся после первой версии базы.
+// Вызывается при каждом запуске, поэтому все запросы идемпотентны.
+func migrateDatabase(db *sql.DB) error {
+	createHolidaysSQL := `
+    CREATE TABLE IF NOT EXISTS holidays (
+        date TEXT PRIMARY KEY,
+        title TEXT NOT NULL DEFAULT '',
+        workday INTEGER NOT NULL DEFAULT 0
+    );`
+
+	_, err := db.Exec(createHolidaysSQL)
+	if err != nil {
+		return fmt.Errorf("Ошибка создания таблицы праздников: %v", err)
+	}
+
+	createExdatesSQL := `
+    CREATE TABLE IF NOT EXISTS exdates (
+        task_id INTEGER NOT NULL REFERENCES scheduler (id) ON DELETE CASCADE,
+        date TEXT NOT NULL,
+        PRIMARY KEY (task_id, date)
+    );`
+
+	_, err = db.Exec(createExdatesSQL)
+	if err != nil {
+		return fmt.Errorf("Ошибка создания таблицы исключений: %v", err)
+	}
+
+	// История выполнения задач с оценками качества для правила sr
+	createReviewsSQL := `
+    CREATE TABLE IF NOT EXISTS reviews (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        task_id INTEGER NOT NULL REFERENCES scheduler (id) ON DELETE CASCADE,
+        date TEXT NOT NULL,
+        quality INTEGER NOT NULL CHECK (quality BETWEEN 0 AND 5)
+    );
+    CREATE INDEX IF NOT EXISTS idx_reviews_task ON reviews (task_id, id);`
+
+	_, err = db.Exec(createReviewsSQL)
+	if err != nil {
+		return fmt.Errorf("Ошибка создания таблицы оценок: %v", err)
+	}
+
+	// Индекс для списка задач, упорядоченного по заголовку
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_scheduler_title ON scheduler (title)`)
+	if err != nil {
+		return fmt.Errorf("Ошибка создания индекса: %v", err)
+	}
+
+	if err := addColumn(db, "scheduler", "time", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumn(db, "scheduler", "tz", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumn(db, "scheduler", "anchor", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumn(db, "scheduler", "overflow", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumn(db, "scheduler", "catchup", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	// Начало серии повторений; у старых задач пустое — серия считается от
+	// текущей даты задачи
+	if err := addColumn(db, "scheduler", "start", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// addColumn добавляет столбец в таблицу, если его там ещё нет.
+func addColumn(db *sql.DB, table, column, definition string) error {
+	var count int
+	err := db.QueryRow(`SELECT count(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("Ошибка чтения структуры таблицы %s: %v", table, err)
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("Ошибка добавления столбца %s.%s: %v", table, column, err)
+	}
+	return nil
+}
+
+// saveHolidaysInDB добавляет или заменяет дни производственного календаря
+// в одной транзакции.
+func saveHolidaysInDB(db *sql.DB, holidays []Holiday) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("Ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT OR REPLACE INTO holidays (date, title, workday) VALUES (?, ?, ?)`
+	for _, h := range holidays {
+		if _, err := tx.Exec(query, h.Date, h.Title, h.Workday); err != nil {
+			return fmt.Errorf("Ошибка при добавлении дня %s: %v", h.Date, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Ошибка сохранения календаря: %v", err)
+	}
+	return nil
+}
+
+// getHolidaysFromDB возвращает дни календаря в промежутке [from, to];
+// пустые границы не ограничивают выборку.
+func getHolidaysFromDB(db *sql.DB, from, to string) ([]Holiday, error) {
+	if to == "" {
+		to = "99999999"
+	}
+	query := `SELECT date, title, workday FROM holidays WHERE date >= ? AND date <= ? ORDER BY date`
+	rows, err := db.Query(query, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка при чтении календаря: %v", err)
+	}
+	defer rows.Close()
+
+	holidays := make([]Holiday, 0)
+	for rows.Next() {
+		var h Holiday
+		if err := rows.Scan(&h.Date, &h.Title, &h.Workday); err != nil {
+			return nil, fmt.Errorf("Ошибка при чтении календаря: %v", err)
+		}
+		holidays = append(holidays, h)
+	}
+	return holidays, rows.Err()
+}
+
+// taskExistsInDB проверяет, есть ли задача с таким id.
+func taskExistsInDB(db querier, id string) (bool, error) {
+	var count int
+	err := db.QueryRow(`SELECT count(*) FROM scheduler WHERE id = ?`, id).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка при поиске задачи: %v", err)
+	}
+	return count > 0, nil
+}
+
+// getExdatesFromDB возвращает даты-исключения задачи по возрастанию.
+func getExdatesFromDB(db querier, id string) ([]string, error) {
+	rows, err := db.Query(`SELECT date FROM exdates WHERE task_id = ? ORDER BY date`, id)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка при чтении исключений: %v", err)
+	}
+	defer rows.Close()
+
+	exdates := make([]string, 0)
+	for rows.Next() {
+		var date string
+		if err := rows.Scan(&date); err != nil {
+			return nil, fmt.Errorf("Ошибка при чтении исключений: %v", err)
+		}
+		exdates = append(exdates, date)
+	}
+	return exdates, rows.Err()
+}
+
+// addExdateInDB добавляет дату-исключение; повторное добавление ничего не
+// меняет. Задача, текущая дата которой отменена, в той же транзакции
+// переносится на следующее повторение.
+func addExdateInDB(db *sql.DB, id, date string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("Ошибка начала транзакции: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT OR IGNORE INTO exdates (task_id, date) VALUES (?, ?)`, id, date)
+	if err != nil {
+		return fmt.Errorf("Ошибка при добавлении исключения: %v", err)
+	}
+	task, err := getTaskFromDB(tx, id)
+	if err != nil {
+		return err
+	}
+	if task.Date == date {
+		exdates, err := getExdatesFromDB(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := skipExcludedDate(&task, exdates); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE scheduler SET date = ?, time = ? WHERE id = ?`, task.Date, task.Time, id)
+		if err != nil {
+			return fmt.Errorf("Ошибка при переносе задачи: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// deleteExdateFromDB удаляет дату-исключение и сообщает, была ли она.
+func deleteExdateFromDB(db *sql.DB, id, date string) (bool, error) {
+	result, err := db.Exec(`DELETE FROM exdates WHERE task_id = ? AND date = ?`, id, date)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка при удалении исключения: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("Ошибка при удалении исключения: %v", err)
+	}
+	return n > 0, nil
+}
+
+// taskColumns — столбцы scheduler в порядке полей, которые читает scanTasks.
+const taskColumns = `id, date, title, comment, repeat, time, tz, anchor, overflow, catchup, start`
+
+// scanTasks читает задачи из результата запроса по столбцам taskColumns.
+func scanTasks(rows *sql.Rows) ([]Task, error) {
+	defer rows.Close()
+	tasks := make([]Task, 0)
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// scanTask читает текущую строку результата по столбцам taskColumns.
+func scanTask(rows *sql.Rows) (Task, error) {
+	var task Task
+	var comment, repeat sql.NullString
+	err := rows.Scan(&task.ID, &task.Date, &task.Title, &comment, &repeat,
+		&task.Time, &task.TZ, &task.Anchor, &task.Overflow, &task.Catchup, &task.Start)
+	if err != nil {
+		return Task{}, fmt.Errorf("Ошибка при чтении задачи: %v", err)
+	}
+	task.Comment, task.Repeat = comment.String, repeat.String
+	return task, nil
+}
+
+// getTasksUntilFromDB возвращает задачи с датой не позже to, то есть все,
+// у которых могут быть повторения до to. Задачи без даты не возвращаются.
+func getTasksUntilFromDB(db *sql.DB, to string) ([]Task, error) {
+	rows, err := db.Query(`SELECT `+taskColumns+` FROM scheduler WHERE date != '' AND date <= ? ORDER BY date, id`, to)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка при чтении задач: %v", err)
+	}
+	return scanTasks(rows)
+}
+
+// Порядок задач в списке.
+const (
+	sortDate    = "date"    // по дате, задачи без даты — в конце
+	sortTitle   = "title"   // по заголовку
+	sortCreated = "created" // в порядке создания
+)
+
+// taskListQuery — параметры выборки задач для списка.
+type taskListQuery struct {
+	Sort string
+	// Непустая Until ограничивает дату сверху и исключает задачи без даты
+	Until string
+	// Условие отбора, проверяется в Go: LOWER и LIKE в SQLite не учитывают
+	// регистр кириллицы; nil — все задачи
+	Match func(Task) bool
+	// Ключ и id последней задачи предыдущей страницы
+	After *taskCursor
+	Limit int
+}
+
+// listTasksFromDB возвращает не больше q.Limit задач в порядке q.Sort,
+// идущих после q.After. Порядок всегда дополняется id, поэтому он
+// устойчив, и страницы не теряют и не повторяют задачи.
+func listTasksFromDB(db *sql.DB, q taskListQuery) ([]Task, error) {
+	type part struct {
+		where string
+		args  []any
+		order string
+	}
+	var parts []part
+	until := part{where: "1 = 1"}
+	if q.Until != "" {
+		until = part{where: "date != '' AND date <= ?", args: []any{q.Until}}
+	}
+
+	switch q.Sort {
+	case sortCreated:
+		p := part{where: until.where, args: until.args, order: "id"}
+		if q.After != nil {
+			p.where += " AND id > ?"
+			p.args = append(p.args, q.After.ID)
+		}
+		parts = append(parts, p)
+	case sortTitle:
+		p := part{where: until.where, args: until.args, order: "title, id"}
+		if q.After != nil {
+			p.where += " AND (title > ? OR (title = ? AND id > ?))"
+			p.args = append(p.args, q.After.Key, q.After.Key, q.After.ID)
+		}
+		parts = append(parts, p)
+	default:
+		// Задачи с датой читаются по индексу idx_scheduler_date, задачи без
+		// даты — после них; пустой ключ курсора значит, что задачи с датой
+		// уже закончились
+		if q.After == nil || q.After.Key != "" {
+			p := part{where: "date != ''", order: "date, id"}
+			if q.Until != "" {
+				p.where += " AND date <= ?"
+				p.args = append(p.args, q.Until)
+			}
+			if q.After != nil {
+				p.where += " AND (date > ? OR (date = ? AND id > ?))"
+				p.args = append(p.args, q.After.Key, q.After.Key, q.After.ID)
+			}
+			parts = append(parts, p)
+		}
+		if q.Until == "" {
+			p := part{where: "date = ''", order: "id"}
+			if q.After != nil && q.After.Key == "" {
+				p.where += " AND id > ?"
+				p.args = append(p.args, q.After.ID)
+			}
+			parts = append(parts, p)
+		}
+	}
+
+	tasks := make([]Task, 0)
+	for _, p := range parts {
+		query := `SELECT ` + taskColumns + ` FROM scheduler WHERE ` + p.where + ` ORDER BY ` + p.order
+		if q.Match == nil {
+			query += ` LIMIT ?`
+			p.args = append(p.args, q.Limit-len(tasks))
+		}
+		rows, err := db.Query(query, p.args...)
+		if err != nil {
+			return nil, fmt.Errorf("Ошибка при чтении задач: %v", err)
+		}
+		for rows.Next() && len(tasks) < q.Limit {
+			task, err := scanTask(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if q.Match == nil || q.Match(task) {
+				tasks = append(tasks, task)
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Ошибка при чтении задач: %v", err)
+		}
+		if len(tasks) == q.Limit {
+			break
+		}
+	}
+	return tasks, nil
+}
+
+// getAllExdatesFromDB возвращает даты-исключения всех задач до to.
+func getAllExdatesFromDB(db *sql.DB, to string) (map[int64][]string, error) {
+	rows, err := db.Query(`SELECT task_id, date FROM exdates WHERE date <= ? ORDER BY task_id, date`, to)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка при чтении исключений: %v", err)
+	}
+	defer rows.Close()
+
+	exdates := make(map[int64][]string)
+	for rows.Next() {
+		var id int64
+		var date string
+		if err := rows.Scan(&id, &date); err != nil {
+			return nil, fmt.Errorf("Ошибка при чтении исключений: %v", err)
+		}
+		exdates[id] = append(exdates[id], date)
+	}
+	return exdates, rows.Err()
+}
+
+// getGradesFromTx возвращает оценки выполнения задачи от первой к последней.
+func getGradesFromTx(tx *sql.Tx, id string) ([]int, error) {
+	rows, err := tx.Query(`SELECT quality FROM reviews WHERE task_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка при чтении оценок: %v", err)
+	}
+	defer rows.Close()
+
+	grades := make([]int, 0)
+	for rows.Next() {
+		var q int
+		if err := rows.Scan(&q); err != nil {
+			return nil, fmt.Errorf("Ошибка при чтении оценок: %v", err)
+		}
+		grades = append(grades, q)
+	}
+	return grades, rows.Err()
+}
+
+// addReviewInTx записывает выполнение задачи в день date с оценкой quality.
+func addReviewInTx(tx *sql.Tx, id, date string, quality int) error {
+	_, err := tx.Exec(`INSERT INTO reviews (task_id, date, quality) VALUES (?, ?, ?)`, id, date, quality)
+	if err != nil {
+		return fmt.Errorf("Ошибка при сохранении оценки: %v", err)
+	}
+	return nil
+}
+
+// dependentsInTx возвращает правила задач, ждущих выполнения задачи id,
+// по их id.
+func dependentsInTx(tx *sql.Tx, id string) (map[int64]string, error) {
+	rows, err := tx.Query(`SELECT id, repeat FROM scheduler WHERE date = '' AND repeat LIKE 'after %'`)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка при поиске зависимых задач: %v", err)
+	}
+	defer rows.Close()
+
+	dependents := make(map[int64]string)
+	for rows.Next() {
+		var depID int64
+		var repeat string
+		if err := rows.Scan(&depID, &repeat); err != nil {
+			return nil, fmt.Errorf("Ошибка при поиске зависимых задач: %v", err)
+		}
+		if trigger, _, _, ok := afterRule(repeat); ok && fmt.Sprint(trigger) == id {
+			dependents[depID] = repeat
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Ошибка при поиске зависимых задач: %v", err)
+	}
+	return dependents, nil
+}
+
+// scheduleDependentsInTx назначает дату задачам, ждущим выполнения задачи
+// id в день done, и возвращает их число.
+func scheduleDependentsInTx(tx *sql.Tx, id string, done time.Time) (int, error) {
+	dependents, err := dependentsInTx(tx, id)
+	if err != nil {
+		return 0, err
+	}
+	for depID, repeat := range dependents {
+		date, err := dependentDate(repeat, done)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(`UPDATE scheduler SET date = ? WHERE id = ?`, date, depID); err != nil {
+			return 0, fmt.Errorf("Ошибка при назначении даты задаче %d: %v", depID, err)
+		}
+	}
+	return len(dependents), nil
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Описание правил повторения обычной фразой: "m -1,15 1,4,7,10" —
+// "15-го и в последний день месяца, в январе, апреле, июле и октябре".
+// Фразы составлены из тех же слов, что понимает ParseRepeatPhrase, поэтому
+// описание правила, полученного из фразы, разбирается обратно в то же правило.
+
+// repeatUnit — формы слова для фраз "каждый день", "каждые 2 дня", "каждые 5 дней".
+type repeatUnit struct {
+	every, one, few, many string
+}
+
+var (
+	unitDay     = repeatUnit{"каждый", "день", "дня", "дней"}
+	unitWeek    = repeatUnit{"каждую", "неделю", "недели", "недель"}
+	unitMonth   = repeatUnit{"каждый", "месяц", "месяца", "месяцев"}
+	unitYear    = repeatUnit{"каждый", "год", "года", "лет"}
+	unitWorkday = repeatUnit{"каждый", "рабочий день", "рабочих дня", "рабочих дней"}
+)
+
+// everyN описывает интервал: "каждый день", "каждые 3 дня", "каждый 21 день".
+func (u repeatUnit) everyN(n int) string {
+	switch {
+	case n == 1:
+		return u.every + " " + u.one
+	case n%10 == 1 && n%100 != 11:
+		return fmt.Sprintf("%s %d %s", u.every, n, u.one)
+	}
+	return fmt.Sprintf("каждые %d %s", n, plural(n, u.one, u.few, u.many))
+}
+
+// plural выбирает форму слова для числа n: 1 день, 2 дня, 5 дней.
+func plural(n int, one, few, many string) string {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return one
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 10 || n%100 >= 20):
+		return few
+	}
+	return many
+}
+
+// Названия дней недели по индексу time.Weekday.
+var (
+	weekdaysDative      = [7]string{"воскресеньям", "понедельникам", "вторникам", "средам", "четвергам", "пятницам", "субботам"}
+	weekdaysAccusative  = [7]string{"воскресенье", "понедельник", "вторник", "среду", "четверг", "пятницу", "субботу"}
+	monthsPrepositional = [13]string{"", "январе", "феврале", "марте", "апреле", "мае", "июне", "июле",
+		"августе", "сентябре", "октябре", "ноябре", "декабре"}
+)
+
+// Порядковые числительные 1..5 в винительном падеже мужского, женского и
+// среднего рода; отрицательные номера отсчитываются с конца месяца.
+var ordinalForms = map[int][3]string{
+	1:  {"первый", "первую", "первое"},
+	2:  {"второй", "вторую", "второе"},
+	3:  {"третий", "третью", "третье"},
+	4:  {"четвертый", "четвертую", "четвертое"},
+	5:  {"пятый", "пятую", "пятое"},
+	-1: {"последний", "последнюю", "последнее"},
+	-2: {"предпоследний", "предпоследнюю", "предпоследнее"},
+}
+
+// weekdayGender — род названия дня недели: 0 — мужской, 1 — женский,
+// 2 — средний.
+func weekdayGender(wd time.Weekday) int {
+	switch wd {
+	case time.Wednesday, time.Friday, time.Saturday:
+		return 1
+	case time.Sunday:
+		return 2
+	}
+	return 0
+}
+
+var modifierPhrases = map[string]string{
+	"+b": "с переносом на рабочий день",
+	"!b": "кроме нерабочих дней",
+	"+h": "с переносом после праздников",
+	"!h": "кроме праздников",
+}
+
+// DescribeRepeat возвращает описание правила повторения. Правило
+// проверяется через NextDate, ошибки возвращаются те же; правило, по
+// которому повторения уже закончились, всё равно описывается.
+func DescribeRepeat(repeat string) (string, error) {
+	today := time.Now().Format("20060102")
+	if _, err := NextDate(time.Now(), today, repeat); err != nil {
+		var repeatErr *RepeatError
+		if !errors.As(err, &repeatErr) || repeatErr.Code != errCodeNoOccurrences {
+			return "", err
+		}
+	}
+
+	fields := ruleFields(repeat)
+	var modifier string
+	if n := len(fields); isDayModifier(fields[n-1].text) {
+		modifier = fields[n-1].text
+		repeat = repeat[:fields[n-1].pos]
+		fields = fields[:n-1]
+	}
+
+	var text string
+	switch {
+	case strings.Contains(repeat, "="):
+		rule, err := parseRRule(repeat)
+		if err != nil {
+			return "", err
+		}
+		text = rule.describe()
+	case fields[0].text == "d":
+		days, _ := strconv.Atoi(fields[1].text)
+		if days%7 == 0 {
+			text = unitWeek.everyN(days / 7)
+		} else {
+			text = unitDay.everyN(days)
+		}
+	case fields[0].text == "y":
+		text = unitYear.everyN(1)
+	case fields[0].text == "w":
+		weekdays, _ := parseWeekdays(fields[1])
+		text = "по " + describeWeekdays(weekdays)
+	case fields[0].text == "m":
+		days, _ := parseMonthDays(fields[1])
+		text = describeMonthDays(days) + describeMonths(fields[2:])
+	case fields[0].text == "n":
+		weekdays, _ := parseNthWeekdays(fields[1])
+		text = describeNthWeekdays(weekdays) + " месяца" + describeMonths(fields[2:])
+	case fields[0].text == "b":
+		days, _ := strconv.Atoi(fields[1].text)
+		text = unitWorkday.everyN(days)
+	case fields[0].text == "cron":
+		text = "по расписанию cron «" + strings.Join(strings.Fields(repeat)[1:], " ") + "»"
+	case fields[0].text == "after":
+		trigger, days, _ := parseAfterRule(repeat, fields)
+		if days == 0 {
+			text = fmt.Sprintf("в день выполнения задачи %d", trigger)
+		} else {
+			text = fmt.Sprintf("через %d %s после выполнения задачи %d", days, plural(days, "день", "дня", "дней"), trigger)
+		}
+	case fields[0].text == "sr":
+		text = "интервальное повторение: чем легче даётся, тем реже"
+		if len(fields) > 1 {
+			text += ", начальная лёгкость " + fields[1].text
+		}
+	}
+
+	if modifier != "" {
+		text += ", " + modifierPhrases[modifier]
+	}
+	return text, nil
+}
+
+// describeWeekdays перечисляет дни недели: "понедельникам и четвергам",
+// "будням", "выходным".
+func describeWeekdays(weekdays [7]bool) string {
+	switch weekdays {
+	case [7]bool{false, true, true, true, true, true, false}:
+		return "будням"
+	case [7]bool{true, false, false, false, false, false, true}:
+		return "выходным"
+	}
+	var names []string
+	// Неделя начинается с понедельника
+	for i := 1; i <= 7; i++ {
+		if weekdays[i%7] {
+			names = append(names, weekdaysDative[i%7])
+		}
+	}
+	return joinPhrases(names)
+}
+
+// describeMonthDays описывает дни месяца: "1-го и 15-го числа",
+// "15-го и в последний день месяца".
+func describeMonthDays(days []int) string {
+	days = uniqueSorted(days, monthDayOrder)
+	var parts []string
+	negative := false
+	for _, day := range days {
+		if day > 0 {
+			parts = append(parts, fmt.Sprintf("%d-го", day))
+			continue
+		}
+		negative = true
+		parts = append(parts, "в "+ordinalForms[day][0])
+	}
+	if negative {
+		return joinPhrases(parts) + " день месяца"
+	}
+	return joinPhrases(parts) + " числа"
+}
+
+// describeNthWeekdays описывает дни недели месяца: "во второй вторник и
+// последнюю пятницу".
+func describeNthWeekdays(weekdays []weekdayNum) string {
+	parts := make([]string, len(weekdays))
+	for i, wn := range weekdays {
+		parts[i] = ordinalWord(wn.ord, weekdayGender(wn.weekday)) + " " + weekdaysAccusative[wn.weekday]
+	}
+	text := joinPhrases(parts)
+	if strings.HasPrefix(text, "втор") {
+		return "во " + text
+	}
+	return "в " + text
+}
+
+// ordinalWord возвращает порядковый номер в нужном роде; номера, для
+// которых нет слова, записываются цифрами.
+func ordinalWord(ord, gender int) string {
+	if forms, ok := ordinalForms[ord]; ok {
+		return forms[gender]
+	}
+	if ord < 0 {
+		if forms, ok := ordinalForms[-ord]; ok {
+			return forms[gender] + " с конца"
+		}
+		return fmt.Sprintf("%d-й с конца", -ord)
+	}
+	return fmt.Sprintf("%d-й", ord)
+}
+
+// describeMonths описывает необязательный список месяцев правил m и n:
+// ", в январе и июле".
+func describeMonths(fields []ruleToken) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	months, _ := parseMonths(fields)
+	var numbers []int
+	for m := 1; m <= 12; m++ {
+		if months[m] {
+			numbers = append(numbers, m)
+		}
+	}
+	return monthsPhrase(numbers)
+}
+
+func monthsPhrase(months []int) string {
+	if len(months) == 0 {
+		return ""
+	}
+	names := make([]string, len(months))
+	for i, m := range months {
+		names[i] = monthsPrepositional[m]
+	}
+	return ", в " + joinPhrases(names)
+}
+
+// joinPhrases соединяет части перечисления: "a", "a и b", "a, b и c".
+func joinPhrases(parts []string) string {
+	if len(parts) < 2 {
+		return strings.Join(parts, "")
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " и " + parts[len(parts)-1]
+}
+
+// describe описывает правило RRULE.
+func (r *rrule) describe() string {
+	var text string
+	switch r.freq {
+	case "DAILY":
+		text = unitDay.everyN(r.interval)
+	case "WEEKLY":
+		text = unitWeek.everyN(r.interval)
+	case "MONTHLY":
+		text = unitMonth.everyN(r.interval)
+	case "YEARLY":
+		text = unitYear.everyN(r.interval)
+	}
+
+	var plain [7]bool
+	var nth []weekdayNum
+	for _, wn := range r.byDay {
+		if wn.ord == 0 {
+			plain[wn.weekday] = true
+		} else {
+			nth = append(nth, wn)
+		}
+	}
+	if len(r.byMonthDay) > 0 {
+		var known, other []int
+		for _, day := range r.byMonthDay {
+			if day >= -2 {
+				known = append(known, day)
+			} else {
+				other = append(other, day)
+			}
+		}
+		var parts []string
+		if len(known) > 0 {
+			parts = append(parts, describeMonthDays(known))
+		}
+		for _, day := range other {
+			parts = append(parts, fmt.Sprintf("в %d-й с конца день месяца", -day))
+		}
+		text += ", " + joinPhrases(parts)
+	}
+	if len(nth) > 0 {
+		period := " месяца"
+		if r.freq == "YEARLY" && len(r.byMonth) == 0 {
+			period = " года"
+		}
+		text += ", " + describeNthWeekdays(nth) + period
+	}
+	if plain != [7]bool{} {
+		text += " по " + describeWeekdays(plain)
+	}
+
+	months := make([]int, len(r.byMonth))
+	for i, m := range r.byMonth {
+		months[i] = int(m)
+	}
+	text += monthsPhrase(uniqueSorted(months, nil))
+
+	if r.count > 0 {
+		text += fmt.Sprintf(", %d %s", r.count, plural(r.count, "раз", "раза", "раз"))
+	}
+	if !r.until.IsZero() {
+		text += ", до " + r.until.Format("02.01.2006")
+	}
+	return text
+}
+
+// repeatDescribeHandler обслуживает /api/repeat/describe: правило
+// передаётся параметром repeat (GET) или полем repeat в JSON (POST).
+func repeatDescribeHandler(w http.ResponseWriter, r *http.Request) {
+	var repeat string
+	switch r.Method {
+	case http.MethodGet:
+		repeat = r.URL.Query().Get("repeat")
+	case http.MethodPost:
+		var req struct {
+			Repeat string `json:"repeat"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Некорректный JSON")
+			return
+		}
+		repeat = req.Repeat
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Метод не разрешен")
+		return
+	}
+
+	text, err := DescribeRepeat(repeat)
+	if err != nil {
+		writeRepeatError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(map[string]string{"repeat": repeat, "text": text})
+}
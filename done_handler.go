@@ -0,0 +1,184 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// srDefaultQuality — оценка выполнения задачи с правилом sr, если клиент
+// её не передал: "вспомнил с небольшим усилием".
+const srDefaultQuality = 4
+
+// doneHandler обслуживает POST /api/task/done?id=: разовая задача
+// удаляется, повторяющаяся переносится на следующую дату по своему правилу.
+// Всё выполняется в одной транзакции.
+//
+// Параметр date — дата, которую клиент отмечает выполненной. Если задача к
+// этому времени уже перенесена (её выполнил другой клиент или повторный
+// щелчок), запрос отклоняется с 409, и задача не перескакивает через
+// период; веб-интерфейс всегда передаёт date. Без date каждый запрос
+// выполняет текущее повторение задачи, каким оно будет в момент запроса.
+// Оценка для правила sr передаётся параметром quality или в теле
+// {"quality": 5}.
+func doneHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Метод не разрешен")
+		return
+	}
+	query := r.URL.Query()
+	id := query.Get("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "Не указан идентификатор задачи")
+		return
+	}
+
+	// -1 — оценка не передана
+	quality := -1
+	if s := query.Get("quality"); s != "" {
+		q, err := strconv.Atoi(s)
+		if err != nil || !isQuality(q) {
+			writeError(w, http.StatusBadRequest, "Оценка quality должна быть числом от 0 до 5")
+			return
+		}
+		quality = q
+	} else {
+		var body struct {
+			Quality *int `json:"quality"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, "Некорректный JSON")
+			return
+		}
+		if body.Quality != nil {
+			if !isQuality(*body.Quality) {
+				writeError(w, http.StatusBadRequest, "Оценка quality должна быть числом от 0 до 5")
+				return
+			}
+			quality = *body.Quality
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Ошибка начала транзакции: %v", err))
+		return
+	}
+	defer tx.Rollback()
+
+	task, err := getTaskFromDB(tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "Задача не найдена")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if date := query.Get("date"); date != "" && date != task.Date {
+		writeError(w, http.StatusConflict, "Задача уже отмечена выполненной: её дата изменилась")
+		return
+	}
+	loc, err := taskLocation(task.TZ)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	now := time.Now().In(loc)
+
+	// Даты зависимым задачам назначаются до того, как выполненная задача
+	// будет удалена: потом их уже нечему будет запланировать
+	if _, err := scheduleDependentsInTx(tx, id, now); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	done, err := completeTaskInTx(tx, task, now, quality)
+	if err != nil {
+		var repeatErr *RepeatError
+		if errors.As(err, &repeatErr) {
+			writeRepeatError(w, err)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !done {
+		writeError(w, http.StatusConflict, "Задача уже отмечена выполненной другим запросом")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Ошибка сохранения задачи: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(struct{}{})
+}
+
+// completeTaskInTx отмечает задачу выполненной в момент now: удаляет
+// разовую или ту, у которой повторения закончились, и переносит
+// повторяющуюся. Зависимая задача снова ждёт выполнения своей задачи, а
+// если той уже нет, удаляется как разовая. Изменение применяется, только
+// если задача с тех пор, как её прочитали, не изменилась; done == false —
+// её уже выполнил другой запрос.
+func completeTaskInTx(tx *sql.Tx, task Task, now time.Time, quality int) (bool, error) {
+	id := strconv.FormatInt(task.ID, 10)
+	if task.Repeat == "" {
+		return deleteTaskInTx(tx, id)
+	}
+	if trigger, _, _, ok := afterRule(task.Repeat); ok {
+		exists, err := taskExistsInDB(tx, strconv.FormatInt(trigger, 10))
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			return deleteTaskInTx(tx, id)
+		}
+	}
+
+	exdates, err := getExdatesFromDB(tx, id)
+	if err != nil {
+		return false, err
+	}
+	opts := RepeatOptions{Exdates: exdates}
+	if isSpacedRule(task.Repeat) {
+		if quality == -1 {
+			quality = srDefaultQuality
+		}
+		grades, err := getGradesFromTx(tx, id)
+		if err != nil {
+			return false, err
+		}
+		opts.Grades = append(grades, quality)
+		if err := addReviewInTx(tx, id, now.Format("20060102"), quality); err != nil {
+			return false, err
+		}
+	}
+
+	date, clock, err := nextTaskDate(now, task, opts)
+	var repeatErr *RepeatError
+	if errors.As(err, &repeatErr) && repeatErr.Code == errCodeNoOccurrences {
+		// Повторения по правилу закончились (COUNT, UNTIL): задача
+		// выполнена окончательно
+		return deleteTaskInTx(tx, id)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	result, err := tx.Exec(`UPDATE scheduler SET date = ?, time = ? WHERE id = ? AND date = ? AND time = ?`,
+		date, clock, id, task.Date, task.Time)
+	if err != nil {
+		return false, fmt.Errorf("Ошибка при переносе задачи: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("Ошибка при переносе задачи: %v", err)
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// exdatesHandler обслуживает /api/task/exdate — даты-исключения
+// повторяющейся задачи id: GET возвращает список, POST добавляет дату date,
+// DELETE удаляет её. Отменённые даты NextDateWith пропускает; если отменена
+// текущая дата задачи, задача переносится на следующее повторение.
+func exdatesHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "Не указан идентификатор задачи")
+		return
+	}
+	exists, err := taskExistsInDB(db, id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, "Задача не найдена")
+		return
+	}
+
+	date := r.URL.Query().Get("date")
+	if r.Method == http.MethodPost || r.Method == http.MethodDelete {
+		if _, err := time.Parse("20060102", date); err != nil {
+			writeError(w, http.StatusBadRequest, "Некорректный формат даты")
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		exdates, err := getExdatesFromDB(db, id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(map[string][]string{"exdates": exdates})
+
+	case http.MethodPost:
+		if err := addExdateInDB(db, id, date); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(struct{}{})
+
+	case http.MethodDelete:
+		deleted, err := deleteExdateFromDB(db, id, date)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !deleted {
+			writeError(w, http.StatusNotFound, "Исключение не найдено")
+			return
+		}
+		json.NewEncoder(w).Encode(struct{}{})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Метод не разрешен")
+	}
+}
+
+// skipExcludedDate переносит задачу, текущая дата которой отменена, на
+// следующее неотменённое повторение. Даты разовых задач и задач с
+// правилами after и sr не следуют из расписания и не меняются; не
+// меняется и дата, после которой повторений по правилу больше нет.
+func skipExcludedDate(task *Task, exdates []string) error {
+	excluded := false
+	for _, exdate := range exdates {
+		excluded = excluded || exdate == task.Date
+	}
+	if !excluded || task.Repeat == "" || isSpacedRule(task.Repeat) {
+		return nil
+	}
+	if _, _, _, ok := afterRule(task.Repeat); ok {
+		return nil
+	}
+	date, err := time.Parse("20060102", task.Date)
+	if err != nil {
+		return err
+	}
+	next, err := NextDateWith(date, task.Date, task.Repeat,
+		RepeatOptions{Exdates: exdates, Overflow: task.Overflow, Start: task.Start})
+	var repeatErr *RepeatError
+	if errors.As(err, &repeatErr) && repeatErr.Code == errCodeNoOccurrences {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	task.Date = next
+	// Правило cron начинает новый день с первого своего времени
+	if cron, ok := cronExpression(task.Repeat); ok && task.Time != "" {
+		task.Time, _ = cron.nextClock("")
+	}
+	return nil
+}
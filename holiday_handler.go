@@ -0,0 +1,271 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Holiday — день производственного календаря: праздник или, при
+// Workday == true, перенесённый рабочий день (например, суббота).
+type Holiday struct {
+	Date    string `json:"date"`
+	Title   string `json:"title"`
+	Workday bool   `json:"workday"`
+}
+
+// holidayCalendar — производственный календарь: дни из таблицы holidays
+// поверх обычной недели с понедельника по пятницу.
+type holidayCalendar struct {
+	mu   sync.RWMutex
+	days map[string]bool // дата → рабочий ли день
+}
+
+func (c *holidayCalendar) IsWorkday(date time.Time) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if workday, ok := c.days[date.Format("20060102")]; ok {
+		return workday
+	}
+	return weekCalendar{}.IsWorkday(date)
+}
+
+func (c *holidayCalendar) IsHoliday(date time.Time) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	workday, ok := c.days[date.Format("20060102")]
+	return ok && !workday
+}
+
+// load перечитывает календарь из базы.
+func (c *holidayCalendar) load(db *sql.DB) error {
+	holidays, err := getHolidaysFromDB(db, "", "")
+	if err != nil {
+		return err
+	}
+	days := make(map[string]bool, len(holidays))
+	for _, h := range holidays {
+		days[h.Date] = h.Workday
+	}
+	c.mu.Lock()
+	c.days = days
+	c.mu.Unlock()
+	return nil
+}
+
+// maxHolidayFileSize ограничивает размер загружаемого календаря.
+const maxHolidayFileSize = 1 << 20
+
+// holidaysHandler обслуживает /api/holidays: GET возвращает дни календаря
+// (параметры from и to необязательны), POST загружает файл .ics или CSV,
+// переданный в теле запроса.
+func holidaysHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, calendar *holidayCalendar) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	switch r.Method {
+	case http.MethodGet:
+		holidays, err := getHolidaysFromDB(db, r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(map[string][]Holiday{"holidays": holidays})
+
+	case http.MethodPost:
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHolidayFileSize))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Ошибка чтения файла календаря")
+			return
+		}
+		holidays, err := parseHolidays(string(data), r.URL.Query().Get("format"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := saveHolidaysInDB(db, holidays); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if err := calendar.load(db); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]int{"imported": len(holidays)})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Метод не разрешен")
+	}
+}
+
+// parseHolidays разбирает календарь в формате format ("ics" или "csv");
+// если формат не указан, он определяется по содержимому.
+func parseHolidays(data, format string) ([]Holiday, error) {
+	if format == "" {
+		format = "csv"
+		if strings.HasPrefix(strings.TrimSpace(data), "BEGIN:VCALENDAR") {
+			format = "ics"
+		}
+	}
+	var holidays []Holiday
+	var err error
+	switch format {
+	case "ics":
+		holidays, err = parseHolidaysICS(data)
+	case "csv":
+		holidays, err = parseHolidaysCSV(data)
+	default:
+		return nil, fmt.Errorf("неизвестный формат календаря: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(holidays) == 0 {
+		return nil, fmt.Errorf("в файле календаря нет ни одного дня")
+	}
+	return holidays, nil
+}
+
+// parseHolidaysICS превращает события VEVENT в дни календаря. Событие
+// длиной в несколько дней (DTEND не включается) даёт несколько дней;
+// событие с CATEGORIES:WORKDAY отмечает перенесённый рабочий день.
+func parseHolidaysICS(data string) ([]Holiday, error) {
+	// Длинные строки iCalendar переносятся, продолжение начинается с пробела
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	var holidays []Holiday
+	var event map[string]string
+	for _, line := range lines {
+		switch {
+		case line == "BEGIN:VEVENT":
+			event = make(map[string]string)
+		case line == "END:VEVENT" && event != nil:
+			days, err := icsEventDays(event)
+			if err != nil {
+				return nil, err
+			}
+			holidays = append(holidays, days...)
+			event = nil
+		case event != nil:
+			nameWithParams, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			name, _, _ := strings.Cut(nameWithParams, ";")
+			event[strings.ToUpper(name)] = value
+		}
+	}
+	return holidays, nil
+}
+
+func icsEventDays(event map[string]string) ([]Holiday, error) {
+	start, err := parseICSDate(event["DTSTART"])
+	if err != nil {
+		return nil, err
+	}
+	end := start.AddDate(0, 0, 1)
+	if value, ok := event["DTEND"]; ok {
+		if end, err = parseICSDate(value); err != nil {
+			return nil, err
+		}
+		if !end.After(start) {
+			end = start.AddDate(0, 0, 1)
+		}
+	}
+	if end.After(start.AddDate(1, 0, 0)) {
+		return nil, fmt.Errorf("событие с %s длиннее года", start.Format("20060102"))
+	}
+
+	title := strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(event["SUMMARY"])
+	workday := false
+	for _, category := range strings.Split(event["CATEGORIES"], ",") {
+		if strings.EqualFold(strings.TrimSpace(category), "WORKDAY") {
+			workday = true
+		}
+	}
+
+	var days []Holiday
+	for date := start; date.Before(end); date = date.AddDate(0, 0, 1) {
+		days = append(days, Holiday{Date: date.Format("20060102"), Title: title, Workday: workday})
+	}
+	return days, nil
+}
+
+// parseICSDate принимает DATE или DATE-TIME; время отбрасывается.
+func parseICSDate(value string) (time.Time, error) {
+	datePart, _, _ := strings.Cut(strings.TrimSpace(value), "T")
+	date, err := time.Parse("20060102", datePart)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("некорректная дата в календаре: %s", value)
+	}
+	return date, nil
+}
+
+// parseHolidaysCSV разбирает строки "дата,название[,рабочий]". Дата
+// записывается как 20060102, 02.01.2006 или 2006-01-02; третье поле
+// ("1", "true", "рабочий") отмечает перенесённый рабочий день. Разделителем
+// может быть запятая или точка с запятой, строка заголовка пропускается.
+func parseHolidaysCSV(data string) ([]Holiday, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	firstLine, _, _ := strings.Cut(data, "\n")
+	if strings.Contains(firstLine, ";") && !strings.Contains(firstLine, ",") {
+		reader.Comma = ';'
+	}
+
+	var holidays []Holiday
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ошибка разбора CSV: %v", err)
+		}
+		date, err := parseHolidayDate(record[0])
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("строка %d: некорректная дата %s", line, record[0])
+		}
+		h := Holiday{Date: date.Format("20060102")}
+		if len(record) > 1 {
+			h.Title = strings.TrimSpace(record[1])
+		}
+		if len(record) > 2 {
+			switch strings.ToLower(strings.TrimSpace(record[2])) {
+			case "1", "true", "workday", "рабочий":
+				h.Workday = true
+			}
+		}
+		holidays = append(holidays, h)
+	}
+	return holidays, nil
+}
+
+func parseHolidayDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	var err error
+	for _, layout := range []string{"20060102", "02.01.2006", "2006-01-02"} {
+		var date time.Time
+		if date, err = time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, err
+}
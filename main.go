@@ -3,69 +3,67 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
+	"strconv"
 	"time"
+	_ "time/tzdata"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type Task struct {
-	ID      int64  `db:"id" json:"id"`
+	ID      int64  `db:"id" json:"id,string"`
 	Date    string `db:"date" json:"date"`
 	Title   string `db:"title" json:"title"`
 	Comment string `db:"comment" json:"comment,omitempty"`
 	Repeat  string `db:"repeat" json:"repeat,omitempty"`
+	// Необязательное время "15:04" и часовой пояс задачи; без пояса
+	// используется пояс сервера
+	Time string `db:"time" json:"time,omitempty"`
+	TZ   string `db:"tz" json:"tz,omitempty"`
+	// От чего отсчитывается следующее повторение: от даты по расписанию
+	// ("schedule", по умолчанию) или от дня выполнения ("completion")
+	Anchor string `db:"anchor" json:"anchor,omitempty"`
+	// Что делать с повторением, дня которого нет в месяце: "forward",
+	// "clamp" или "skip"; по умолчанию — как принято в правиле
+	Overflow string `db:"overflow" json:"overflow,omitempty"`
+	// Как поступать с пропущенными повторениями просроченной задачи:
+	// "skip" (по умолчанию), "one" или "each"
+	Catchup string `db:"catchup" json:"catchup,omitempty"`
+	// Первая дата серии повторений: дата, с которой задачу создали или на
+	// которую её перенесли вручную. Выполнение её не меняет
+	Start string `db:"start" json:"-"`
+	// Описание правила повторения для показа в списке, в базе не хранится
+	RepeatText string `db:"-" json:"repeat_text,omitempty"`
 }
 
+// createTask создаёт задачу и возвращает её id: {"id": "1"}.
 func createTask(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
-		return
-	}
-
 	var task Task
 	err := json.NewDecoder(r.Body).Decode(&task)
 	if err != nil {
-		http.Error(w, "Decoding JSON Error", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Некорректный JSON")
 		return
 	}
-	if strings.TrimSpace(task.Title) == "" {
-		http.Error(w, "Task name cannot be empty", http.StatusBadRequest)
+	// id новой задаче назначает база
+	task.ID = 0
+	if status, err := prepareTask(db, &task, nil); err != nil {
+		writeTaskError(w, status, err)
 		return
 	}
-	now := time.Now().Format("20060102")
-
-	if task.Date == "" {
-		task.Date = now
-	} else {
-		parsedDate, err := time.Parse("20060102", task.Date)
-		if err != nil {
-			http.Error(w, "Некорректный формат даты", http.StatusBadRequest)
-			return
-		}
-
-		if parsedDate.Format("20060102") < now {
-			if strings.TrimSpace(task.Repeat) == "" {
-				task.Date = now
-			}
-		}
-	}
 	id, err := createTaskInDB(db, task)
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(err.Error())
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	fmt.Println(id)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(id)
+	json.NewEncoder(w).Encode(map[string]string{"id": id})
 }
+
 func main() {
 	dbFile := os.Getenv("TODO_DBFILE")
 
@@ -87,7 +85,10 @@ func main() {
 		log.Fatal(err)
 	}
 
-	db, err := sql.Open("sqlite3", dbFile)
+	// Транзакция сразу берёт блокировку на запись, а занятая база ждёт
+	// освобождения: одновременные отметки выполнения не падают с
+	// "database is locked", а выполняются по очереди
+	db, err := sql.Open("sqlite3", dbFile+"?_txlock=immediate&_busy_timeout=5000")
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -98,6 +99,29 @@ func main() {
 			log.Fatal(err)
 		}
 	}
+	if err := migrateDatabase(db); err != nil {
+		log.Fatal(err)
+	}
+
+	holidays := &holidayCalendar{}
+	if err := holidays.load(db); err != nil {
+		log.Fatal(err)
+	}
+	workCalendar = holidays
+
+	if tz := os.Getenv("TODO_TZ"); tz != "" {
+		serverLocation, err = time.LoadLocation(tz)
+		if err != nil {
+			log.Fatalf("Некорректный часовой пояс TODO_TZ: %v", err)
+		}
+	}
+
+	if limit := os.Getenv("TODO_TASKS_LIMIT"); limit != "" {
+		tasksLimit, err = strconv.Atoi(limit)
+		if err != nil || tasksLimit < 1 {
+			log.Fatalf("Некорректное число задач TODO_TASKS_LIMIT: %s", limit)
+		}
+	}
 
 	port := os.Getenv("TODO_PORT")
 	if port == "" {
@@ -108,9 +132,26 @@ func main() {
 
 	http.Handle("/", indexPage)
 	http.HandleFunc("/api/task", func(w http.ResponseWriter, r *http.Request) {
-		createTask(w, r, db)
+		taskHandler(w, r, db)
+	})
+	http.HandleFunc("/api/tasks", func(w http.ResponseWriter, r *http.Request) {
+		tasksHandler(w, r, db)
+	})
+	http.HandleFunc("/api/task/done", func(w http.ResponseWriter, r *http.Request) {
+		doneHandler(w, r, db)
+	})
+	http.HandleFunc("/api/task/exdate", func(w http.ResponseWriter, r *http.Request) {
+		exdatesHandler(w, r, db)
+	})
+	http.HandleFunc("/api/calendar", func(w http.ResponseWriter, r *http.Request) {
+		calendarHandler(w, r, db)
 	})
 	http.HandleFunc("/api/nextdate", nextDateHandler)
+	http.HandleFunc("/api/repeat/parse", repeatParseHandler)
+	http.HandleFunc("/api/repeat/describe", repeatDescribeHandler)
+	http.HandleFunc("/api/holidays", func(w http.ResponseWriter, r *http.Request) {
+		holidaysHandler(w, r, db, holidays)
+	})
 
 	error := http.ListenAndServe(":"+port, nil)
 
@@ -0,0 +1,605 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Разбор правил повторения, записанных обычными словами по-русски или
+// по-английски: "каждую неделю по понедельникам", "every 2 weeks on Friday",
+// "последний день месяца". Результат — правило в том виде, который
+// понимает NextDate.
+
+// Вид слова во фразе.
+const (
+	wordFiller = iota
+	wordEvery
+	wordNumber
+	wordOrdinal
+	wordUnit
+	wordWorkday
+	wordWeekday
+	wordMonth
+	wordFromEnd
+)
+
+// phraseWord — распознанное слово фразы.
+type phraseWord struct {
+	kind     int
+	value    int    // число, порядковый номер или месяц
+	unit     string // "day", "week", "month", "year" для wordUnit и wordEvery
+	weekdays []int  // 1..7 для wordWeekday
+	suffixed bool   // число с окончанием: "15-го", "2nd"
+	tok      ruleToken
+}
+
+// phraseModifiers — обороты, задающие модификатор правила.
+var phraseModifiers = []struct {
+	re       *regexp.Regexp
+	modifier string
+}{
+	{regexp.MustCompile(`(с )?перенос\S* (на )?(ближайший |следующий )?рабоч\S* (день|дни)`), "+b"},
+	{regexp.MustCompile(`(с )?перенос\S* (с |после )?праздн\S*( дней| дни)?`), "+h"},
+	{regexp.MustCompile(`(кроме|пропуская) (выходн|нерабоч)\S*( дней| дни)?`), "!b"},
+	{regexp.MustCompile(`(кроме|пропуская) праздн\S*( дней| дни)?`), "!h"},
+	{regexp.MustCompile(`(moved|shifted) (to|onto) (the )?(next |nearest )?(working|business) day`), "+b"},
+	{regexp.MustCompile(`(moved|shifted) (off|after) holidays`), "+h"},
+	{regexp.MustCompile(`(skipping|except( on)?) (weekends|non working days)`), "!b"},
+	{regexp.MustCompile(`(skipping|except( on)?) holidays`), "!h"},
+}
+
+var (
+	phraseFillers = wordSet("и в во по на с со числа число числам го й я ю е ое ого ий ая ую ье ый " +
+		"of the on and in at a an")
+	phraseSuffixes = wordSet("го й я ю е ое ого ий ая ую ье ый")
+	phraseEvery    = wordSet("каждый каждая каждое каждую каждые каждого каждой раз every each once")
+	phraseEveryAdv = map[string]string{
+		"ежедневно": "day", "еженедельно": "week", "ежемесячно": "month", "ежегодно": "year",
+		"daily": "day", "weekly": "week", "monthly": "month", "yearly": "year", "annually": "year",
+	}
+	phraseNumbers = map[string]int{
+		"один": 1, "одну": 1, "два": 2, "две": 2, "двух": 2, "три": 3, "трех": 3, "четыре": 4,
+		"пять": 5, "шесть": 6, "семь": 7, "восемь": 8, "девять": 9, "десять": 10,
+		"one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7,
+		"eight": 8, "nine": 9, "ten": 10, "other": 2,
+	}
+	phraseOrdinals = map[string]int{
+		"первый": 1, "первая": 1, "первое": 1, "первую": 1, "первого": 1, "первой": 1,
+		"второй": 2, "вторая": 2, "второе": 2, "вторую": 2, "второго": 2,
+		"третий": 3, "третья": 3, "третье": 3, "третью": 3, "третьего": 3, "третьей": 3,
+		"четвертый": 4, "четвертая": 4, "четвертое": 4, "четвертую": 4, "четвертого": 4, "четвертой": 4,
+		"пятый": 5, "пятая": 5, "пятое": 5, "пятую": 5, "пятого": 5, "пятой": 5,
+		"последний": -1, "последняя": -1, "последнее": -1, "последнюю": -1, "последнего": -1, "последней": -1,
+		"предпоследний": -2, "предпоследняя": -2, "предпоследнее": -2, "предпоследнюю": -2,
+		"предпоследнего": -2, "предпоследней": -2,
+		"first": 1, "second": 2, "third": 3, "fourth": 4, "fifth": 5, "last": -1, "penultimate": -2,
+	}
+	phraseUnits = map[string]string{
+		"день": "day", "дня": "day", "дней": "day", "дни": "day", "дням": "day", "сутки": "day", "суток": "day",
+		"неделя": "week", "неделю": "week", "недели": "week", "недель": "week",
+		"месяц": "month", "месяца": "month", "месяцев": "month", "месяце": "month",
+		"год": "year", "года": "year", "лет": "year", "году": "year",
+		"day": "day", "days": "day", "week": "week", "weeks": "week",
+		"month": "month", "months": "month", "year": "year", "years": "year",
+	}
+	phraseWorkdays = wordSet("рабочий рабочих рабочим рабочие рабочего working business")
+	// Дни недели: основы русских слов, сокращения и английские названия
+	phraseWeekdayStems = []struct {
+		stem    string
+		weekday int
+	}{
+		{"понедельн", 1}, {"вторник", 2}, {"сред", 3}, {"четверг", 4},
+		{"пятниц", 5}, {"суббот", 6}, {"воскресен", 7},
+	}
+	phraseWeekdayWords = map[string][]int{
+		"пн": {1}, "вт": {2}, "ср": {3}, "чт": {4}, "пт": {5}, "сб": {6}, "вс": {7},
+		"monday": {1}, "mondays": {1}, "mon": {1}, "tuesday": {2}, "tuesdays": {2}, "tue": {2}, "tues": {2},
+		"wednesday": {3}, "wednesdays": {3}, "wed": {3}, "thursday": {4}, "thursdays": {4}, "thu": {4},
+		"thurs": {4}, "friday": {5}, "fridays": {5}, "fri": {5}, "saturday": {6}, "saturdays": {6},
+		"sat": {6}, "sunday": {7}, "sundays": {7}, "sun": {7},
+		"будни": {1, 2, 3, 4, 5}, "будням": {1, 2, 3, 4, 5}, "будний": {1, 2, 3, 4, 5},
+		"weekday": {1, 2, 3, 4, 5}, "weekdays": {1, 2, 3, 4, 5},
+		"выходные": {6, 7}, "выходным": {6, 7}, "weekend": {6, 7}, "weekends": {6, 7},
+	}
+	phraseMonthStems = []string{"январ", "феврал", "март", "апрел", "", "июн", "июл",
+		"август", "сентябр", "октябр", "ноябр", "декабр"}
+	phraseMonthWords = map[string]int{
+		"май": 5, "мая": 5, "мае": 5,
+		"january": 1, "jan": 1, "february": 2, "feb": 2, "march": 3, "mar": 3, "april": 4, "apr": 4,
+		"may": 5, "june": 6, "jun": 6, "july": 7, "jul": 7, "august": 8, "aug": 8,
+		"september": 9, "sep": 9, "sept": 9, "october": 10, "oct": 10, "november": 11, "nov": 11,
+		"december": 12, "dec": 12,
+	}
+	phraseSuffixedNumber = regexp.MustCompile(`^(\d+)(st|nd|rd|th)$`)
+	phrasePunctuation    = strings.NewReplacer(",", " ", ".", " ", ";", " ", ":", " ", "!", " ", "?", " ",
+		"(", " ", ")", " ", "-", " ", "ё", "е", "Ё", "е")
+)
+
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// classifyWord определяет вид слова фразы; ok == false для незнакомых слов.
+func classifyWord(tok ruleToken) (phraseWord, bool) {
+	text := tok.text
+	word := phraseWord{tok: tok}
+	if n, err := strconv.Atoi(text); err == nil {
+		word.kind, word.value = wordNumber, n
+		return word, true
+	}
+	if m := phraseSuffixedNumber.FindStringSubmatch(text); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		word.kind, word.value, word.suffixed = wordNumber, n, true
+		return word, true
+	}
+	if n, ok := phraseNumbers[text]; ok {
+		word.kind, word.value = wordNumber, n
+		return word, true
+	}
+	if n, ok := phraseOrdinals[text]; ok {
+		word.kind, word.value = wordOrdinal, n
+		return word, true
+	}
+	if phraseEvery[text] {
+		word.kind = wordEvery
+		return word, true
+	}
+	if unit, ok := phraseEveryAdv[text]; ok {
+		word.kind, word.unit = wordEvery, unit
+		return word, true
+	}
+	if unit, ok := phraseUnits[text]; ok {
+		word.kind, word.unit = wordUnit, unit
+		return word, true
+	}
+	if phraseWorkdays[text] {
+		word.kind = wordWorkday
+		return word, true
+	}
+	if wd, ok := phraseWeekdayWords[text]; ok {
+		word.kind, word.weekdays = wordWeekday, wd
+		return word, true
+	}
+	for _, s := range phraseWeekdayStems {
+		if strings.HasPrefix(text, s.stem) {
+			word.kind, word.weekdays = wordWeekday, []int{s.weekday}
+			return word, true
+		}
+	}
+	if m, ok := phraseMonthWords[text]; ok {
+		word.kind, word.value = wordMonth, m
+		return word, true
+	}
+	for i, stem := range phraseMonthStems {
+		// У мая слишком короткая основа, он разбирается по словарю выше
+		if stem != "" && strings.HasPrefix(text, stem) {
+			word.kind, word.value = wordMonth, i+1
+			return word, true
+		}
+	}
+	if text == "конца" {
+		// "третий с конца понедельник"
+		word.kind = wordFromEnd
+		return word, true
+	}
+	if phraseFillers[text] {
+		word.kind = wordFiller
+		return word, true
+	}
+	return word, false
+}
+
+// phraseRule собирает части правила по мере разбора фразы.
+type phraseRule struct {
+	interval    int
+	unit        string
+	unitTok     ruleToken // слово, с которого начинается интервал
+	weekdays    []int
+	nthWeekdays [][2]int // порядковый номер и день недели
+	monthDays   []int
+	months      []int
+	modifier    string
+}
+
+// lowerPhrase приводит фразу к нижнему регистру. Строчная буква может
+// занимать другое число байт, чем заглавная (Ⱥ и ⱥ), поэтому вместе с
+// текстом возвращается смещение в исходной фразе для каждого байта текста
+// и для его конца.
+func lowerPhrase(phrase string) (string, []int) {
+	var b strings.Builder
+	offsets := make([]int, 0, len(phrase)+1)
+	for i, r := range phrase {
+		n := b.Len()
+		b.WriteRune(unicode.ToLower(r))
+		for ; n < b.Len(); n++ {
+			offsets = append(offsets, i)
+		}
+	}
+	return b.String(), append(offsets, len(phrase))
+}
+
+// ParseRepeatPhrase переводит фразу в правило повторения и проверяет его
+// через NextDate.
+func ParseRepeatPhrase(phrase string) (string, error) {
+	text, offsets := lowerPhrase(phrase)
+	// Ошибки указывают на слова исходной фразы
+	original := func(start, end int) ruleToken {
+		return ruleToken{phrase[offsets[start]:offsets[end]], offsets[start]}
+	}
+	text = phrasePunctuation.Replace(text)
+	// "second to last" и "next to last" — одно слово по смыслу
+	text = strings.NewReplacer("second to last", "penultimate   ", "next to last", "penultimate ").Replace(text)
+
+	var rule phraseRule
+	for _, m := range phraseModifiers {
+		loc := m.re.FindStringIndex(text)
+		if loc == nil {
+			continue
+		}
+		if rule.modifier != "" {
+			return "", newRepeatError(errCodeConflict, original(loc[0], loc[1]),
+				"во фразе указано несколько переносов")
+		}
+		rule.modifier = m.modifier
+		// Заменяем оборот пробелами той же длины, чтобы не сбить позиции
+		text = text[:loc[0]] + strings.Repeat(" ", loc[1]-loc[0]) + text[loc[1]:]
+	}
+
+	var words []phraseWord
+	for _, tok := range ruleFields(text) {
+		word, ok := classifyWord(tok)
+		word.tok = original(tok.pos, tok.pos+len(tok.text))
+		if !ok {
+			return "", newRepeatError(errCodeUnknownRule, word.tok, "непонятное слово: %s", word.tok.text)
+		}
+		// "15-го" после замены дефиса — число и отдельное окончание
+		if phraseSuffixes[tok.text] && len(words) > 0 && words[len(words)-1].kind == wordNumber {
+			words[len(words)-1].suffixed = true
+			continue
+		}
+		if word.kind != wordFiller {
+			words = append(words, word)
+		}
+	}
+	if len(words) == 0 {
+		return "", &RepeatError{Code: errCodeEmptyRule, Position: 0, Message: "фраза не содержит правила повторения"}
+	}
+
+	if err := rule.collect(words); err != nil {
+		return "", err
+	}
+	repeat, err := rule.build()
+	if err != nil {
+		return "", err
+	}
+	if _, err := NextDate(time.Now(), time.Now().Format("20060102"), repeat); err != nil {
+		return "", err
+	}
+	return repeat, nil
+}
+
+// collect разбирает последовательность слов в части правила.
+func (r *phraseRule) collect(words []phraseWord) error {
+	var pending []int // порядковые номера, ждущие дня недели или слова "день"
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		next := func(k int) *phraseWord {
+			if i+k < len(words) {
+				return &words[i+k]
+			}
+			return nil
+		}
+
+		switch word.kind {
+		case wordEvery:
+			if word.unit != "" {
+				r.setInterval(1, word.unit, word.tok)
+				continue
+			}
+			// "каждые 3 дня", "каждую вторую неделю", "every other friday"
+			n := 1
+			k := 1
+			if w := next(1); w != nil && (w.kind == wordNumber && !w.suffixed || w.kind == wordOrdinal && w.value > 0) {
+				if after := next(2); after != nil && (after.kind == wordUnit || after.kind == wordWorkday ||
+					after.kind == wordWeekday && w.kind == wordNumber) {
+					n, k = w.value, 2
+				}
+			}
+			w := next(k)
+			switch {
+			case w != nil && w.kind == wordWorkday:
+				if unit := next(k + 1); unit != nil && unit.kind == wordUnit && unit.unit == "day" {
+					r.setInterval(n, "workday", word.tok)
+					i += k + 1
+				}
+			case w != nil && w.kind == wordUnit:
+				r.setInterval(n, w.unit, word.tok)
+				i += k
+			case w != nil && w.kind == wordWeekday && n > 1:
+				r.setInterval(n, "week", word.tok)
+				i += k - 1
+			}
+
+		case wordWorkday:
+			// "по рабочим дням", "каждый рабочий день"
+			if w := next(1); w != nil && w.kind == wordUnit && w.unit == "day" {
+				r.setInterval(1, "workday", word.tok)
+				i++
+			}
+
+		case wordOrdinal:
+			pending = append(pending, word.value)
+			if w := next(1); w != nil && w.kind == wordUnit && w.unit == "day" {
+				r.monthDays = append(r.monthDays, pending...)
+				pending = nil
+				i++
+			}
+
+		case wordNumber:
+			w := next(1)
+			switch {
+			case word.suffixed && w != nil && w.kind == wordWeekday:
+				if word.value < 1 || word.value > 5 {
+					return newRepeatError(errCodeInvalidValue, word.tok, "некорректный порядковый номер: %s", word.tok.text)
+				}
+				pending = append(pending, word.value)
+			case !word.suffixed && w != nil && (w.kind == wordUnit || w.kind == wordWorkday):
+				// Число с единицей без "каждые": "раз в 2 недели"
+				if w.kind == wordWorkday {
+					r.setInterval(word.value, "workday", word.tok)
+					i++
+					if u := next(2); u != nil && u.kind == wordUnit {
+						i++
+					}
+				} else {
+					r.setInterval(word.value, w.unit, word.tok)
+					i++
+				}
+			default:
+				if word.value < 1 || word.value > 31 {
+					return newRepeatError(errCodeInvalidValue, word.tok, "некорректный день месяца: %s", word.tok.text)
+				}
+				r.monthDays = append(r.monthDays, word.value)
+			}
+
+		case wordWeekday:
+			if len(pending) > 0 {
+				for _, ord := range pending {
+					for _, wd := range word.weekdays {
+						r.nthWeekdays = append(r.nthWeekdays, [2]int{ord, wd})
+					}
+				}
+				pending = nil
+				continue
+			}
+			r.weekdays = append(r.weekdays, word.weekdays...)
+
+		case wordMonth:
+			r.months = append(r.months, word.value)
+
+		case wordFromEnd:
+			if n := len(pending); n > 0 && pending[n-1] > 0 {
+				pending[n-1] = -pending[n-1]
+			}
+
+		case wordUnit:
+			// "месяца" в "последний день месяца" и подобное не меняют правило
+		}
+	}
+	if len(pending) > 0 {
+		return &RepeatError{Code: errCodeInvalidFormat, Position: -1,
+			Message: "после порядкового номера ожидается день недели или слово «день»"}
+	}
+	return nil
+}
+
+func (r *phraseRule) setInterval(n int, unit string, tok ruleToken) {
+	r.interval, r.unit, r.unitTok = n, unit, tok
+}
+
+// conflict называет части правила, которые нельзя совместить с интервалом:
+// дни недели повторяются по неделям, дни месяца — по месяцам, а по годам —
+// только вместе с месяцами.
+func (r *phraseRule) conflict() string {
+	if r.unit == "" {
+		return ""
+	}
+	switch {
+	case len(r.nthWeekdays) > 0 || len(r.monthDays) > 0:
+		if r.unit == "month" || r.unit == "year" && r.interval == 1 && len(r.months) > 0 {
+			return ""
+		}
+		return "днями месяца"
+	case len(r.weekdays) > 0 && r.unit != "week":
+		return "днями недели"
+	}
+	return ""
+}
+
+// monthlyInterval сообщает, что дни месяца повторяются не каждый месяц:
+// такое правило записывается только через RRULE.
+func (r *phraseRule) monthlyInterval() bool {
+	return r.unit == "month" && r.interval > 1
+}
+
+// build собирает правило в каноническом виде: списки упорядочены, чтобы
+// одна и та же фраза всегда давала одну и ту же строку.
+func (r *phraseRule) build() (string, error) {
+	if parts := r.conflict(); parts != "" {
+		return "", newRepeatError(errCodeConflict, r.unitTok,
+			"интервал «%s» нельзя совместить с %s", r.unitTok.text, parts)
+	}
+	months := joinInts(uniqueSorted(r.months, nil))
+	var repeat string
+
+	switch {
+	case len(r.nthWeekdays) > 0:
+		items := make([]string, 0, len(r.nthWeekdays))
+		sort.Slice(r.nthWeekdays, func(i, j int) bool {
+			a, b := r.nthWeekdays[i], r.nthWeekdays[j]
+			if a[0] != b[0] {
+				return monthDayOrder(a[0]) < monthDayOrder(b[0])
+			}
+			return a[1] < b[1]
+		})
+		for i, nw := range r.nthWeekdays {
+			if i > 0 && nw == r.nthWeekdays[i-1] {
+				continue
+			}
+			if r.monthlyInterval() {
+				items = append(items, fmt.Sprintf("%d%s", nw[0], rruleWeekdayNames[nw[1]%7]))
+			} else {
+				items = append(items, fmt.Sprintf("%d:%d", nw[0], nw[1]))
+			}
+		}
+		if r.monthlyInterval() {
+			repeat = fmt.Sprintf("FREQ=MONTHLY;INTERVAL=%d;BYDAY=%s", r.interval, strings.Join(items, ","))
+			if months != "" {
+				repeat += ";BYMONTH=" + months
+			}
+			break
+		}
+		repeat = "n " + strings.Join(items, ",")
+		if months != "" {
+			repeat += " " + months
+		}
+
+	case len(r.monthDays) > 0:
+		days := joinInts(uniqueSorted(r.monthDays, monthDayOrder))
+		if r.monthlyInterval() {
+			repeat = fmt.Sprintf("FREQ=MONTHLY;INTERVAL=%d;BYMONTHDAY=%s", r.interval, days)
+			if months != "" {
+				repeat += ";BYMONTH=" + months
+			}
+			break
+		}
+		repeat = "m " + days
+		if months != "" {
+			repeat += " " + months
+		}
+
+	case len(r.weekdays) > 0:
+		weekdays := uniqueSorted(r.weekdays, nil)
+		if r.unit == "week" && r.interval > 1 || months != "" {
+			byDay := make([]string, 0, len(weekdays))
+			for _, wd := range weekdays {
+				byDay = append(byDay, rruleWeekdayNames[wd%7])
+			}
+			repeat = "FREQ=WEEKLY"
+			if r.interval > 1 {
+				repeat += fmt.Sprintf(";INTERVAL=%d", r.interval)
+			}
+			repeat += ";BYDAY=" + strings.Join(byDay, ",")
+			if months != "" {
+				repeat += ";BYMONTH=" + months
+			}
+		} else {
+			repeat = "w " + joinInts(weekdays)
+		}
+
+	case months != "":
+		return "", &RepeatError{Code: errCodeInvalidFormat, Position: -1,
+			Message: "для месяцев не указан день"}
+
+	case r.unit == "day":
+		repeat = fmt.Sprintf("d %d", r.interval)
+	case r.unit == "week":
+		repeat = fmt.Sprintf("d %d", r.interval*7)
+	case r.unit == "workday":
+		repeat = fmt.Sprintf("b %d", r.interval)
+	case r.unit == "month":
+		repeat = "FREQ=MONTHLY"
+		if r.interval > 1 {
+			repeat += fmt.Sprintf(";INTERVAL=%d", r.interval)
+		}
+	case r.unit == "year" && r.interval == 1:
+		repeat = "y"
+	case r.unit == "year":
+		repeat = fmt.Sprintf("FREQ=YEARLY;INTERVAL=%d", r.interval)
+
+	default:
+		return "", &RepeatError{Code: errCodeInvalidFormat, Position: -1,
+			Message: "во фразе не найдено, как часто повторять задачу"}
+	}
+
+	if r.modifier != "" {
+		repeat += " " + r.modifier
+	}
+	return repeat, nil
+}
+
+// rruleWeekdayNames — названия дней недели RFC 5545 по индексу time.Weekday.
+var rruleWeekdayNames = [7]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// monthDayOrder упорядочивает дни месяца по времени: сначала числа,
+// затем предпоследний и последний день.
+func monthDayOrder(day int) int {
+	if day < 0 {
+		return 100 + day
+	}
+	return day
+}
+
+func uniqueSorted(values []int, key func(int) int) []int {
+	if key == nil {
+		key = func(v int) int { return v }
+	}
+	sorted := append([]int(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return key(sorted[i]) < key(sorted[j]) })
+	unique := sorted[:0]
+	for i, v := range sorted {
+		if i == 0 || v != sorted[i-1] {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// repeatParseHandler обслуживает /api/repeat/parse: фраза передаётся
+// параметром text (GET) или полем text в JSON (POST).
+func repeatParseHandler(w http.ResponseWriter, r *http.Request) {
+	var text string
+	switch r.Method {
+	case http.MethodGet:
+		text = r.URL.Query().Get("text")
+	case http.MethodPost:
+		var req struct {
+			Text string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Некорректный JSON")
+			return
+		}
+		text = req.Text
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Метод не разрешен")
+		return
+	}
+
+	repeat, err := ParseRepeatPhrase(text)
+	if err != nil {
+		writeRepeatError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(map[string]string{"repeat": repeat})
+}
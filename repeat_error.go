@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// RepeatError описывает ошибку в правиле повторения так, чтобы клиент мог
+// показать её пользователю: машиночитаемый код, ошибочный фрагмент правила
+// и его позицию (в байтах от начала строки, -1 — позиция не определена).
+type RepeatError struct {
+	Code     string `json:"code"`
+	Token    string `json:"token,omitempty"`
+	Position int    `json:"position"`
+	Message  string `json:"error"`
+}
+
+func (e *RepeatError) Error() string {
+	return e.Message
+}
+
+// Коды ошибок правила повторения.
+const (
+	errCodeEmptyRule     = "empty_rule"
+	errCodeUnknownRule   = "unknown_rule"
+	errCodeInvalidFormat = "invalid_format"
+	errCodeInvalidValue  = "invalid_value"
+	errCodeUnsupported   = "unsupported"
+	errCodeDuplicatePart = "duplicate_part"
+	errCodeConflict      = "conflict"
+	errCodeNoOccurrences = "no_occurrences"
+	errCodeInvalidRule   = "invalid_rule"
+)
+
+// ruleToken — фрагмент правила повторения и его позиция в исходной строке.
+type ruleToken struct {
+	text string
+	pos  int
+}
+
+func newRepeatError(code string, tok ruleToken, format string, args ...any) *RepeatError {
+	return &RepeatError{
+		Code:     code,
+		Token:    tok.text,
+		Position: tok.pos,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// ruleFields делит правило на части по пробелам, как strings.Fields, но
+// запоминает позицию каждой части.
+func ruleFields(repeat string) []ruleToken {
+	var fields []ruleToken
+	start := -1
+	for i, r := range repeat {
+		switch {
+		case unicode.IsSpace(r) && start >= 0:
+			fields = append(fields, ruleToken{repeat[start:i], start})
+			start = -1
+		case !unicode.IsSpace(r) && start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		fields = append(fields, ruleToken{repeat[start:], start})
+	}
+	return fields
+}
+
+// split делит фрагмент по разделителю, сохраняя позиции частей.
+func (t ruleToken) split(sep string) []ruleToken {
+	var parts []ruleToken
+	pos := t.pos
+	for _, text := range strings.Split(t.text, sep) {
+		parts = append(parts, ruleToken{text, pos})
+		pos += len(text) + len(sep)
+	}
+	return parts
+}
+
+// writeRepeatError отвечает на запрос ошибкой правила повторения в общем
+// виде APIError со статусом 400. Прочие ошибки оборачиваются в RepeatError
+// с общим кодом.
+func writeRepeatError(w http.ResponseWriter, err error) {
+	var repeatErr *RepeatError
+	if !errors.As(err, &repeatErr) {
+		repeatErr = &RepeatError{Code: errCodeInvalidRule, Position: -1, Message: err.Error()}
+	}
+	writeAPIError(w, APIError{
+		Message:  repeatErr.Message,
+		Code:     repeatErr.Code,
+		Status:   http.StatusBadRequest,
+		Token:    repeatErr.Token,
+		Position: &repeatErr.Position,
+	})
+}
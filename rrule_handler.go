@@ -0,0 +1,423 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// weekdayNum — элемент BYDAY: день недели с необязательным порядковым
+// номером (2TU — второй вторник, -1FR — последняя пятница).
+type weekdayNum struct {
+	ord     int
+	weekday time.Weekday
+	tok     ruleToken
+}
+
+// rrule — правило повторения в формате RFC 5545. Поддерживается разрешение
+// до дня: частоты DAILY, WEEKLY, MONTHLY и YEARLY.
+type rrule struct {
+	freq       string
+	interval   int
+	byDay      []weekdayNum
+	byMonthDay []int
+	byMonth    []time.Month
+	count      int
+	until      time.Time
+	wkst       time.Weekday
+	// Что делать, если дня даты задачи нет в месяце; по RFC 5545 такие
+	// повторения пропускаются
+	overflow string
+
+	// Части правила, на которые указывают ошибки при расчёте дат
+	freqTok  ruleToken
+	limitTok ruleToken
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// parseRRule разбирает строку вида "RRULE:FREQ=MONTHLY;BYDAY=-1FR".
+// Префикс "RRULE:" необязателен, регистр не важен.
+func parseRRule(repeat string) (*rrule, error) {
+	value := ruleToken{text: strings.TrimRightFunc(repeat, unicode.IsSpace)}
+	trimmed := strings.TrimLeftFunc(value.text, unicode.IsSpace)
+	value = ruleToken{trimmed, len(value.text) - len(trimmed)}
+	if len(value.text) >= 6 && strings.EqualFold(value.text[:6], "RRULE:") {
+		value = ruleToken{value.text[6:], value.pos + 6}
+	}
+
+	r := &rrule{interval: 1, wkst: time.Monday}
+	seen := make(map[string]ruleToken)
+	for _, part := range value.split(";") {
+		nameText, valText, ok := strings.Cut(part.text, "=")
+		if !ok || valText == "" {
+			return nil, newRepeatError(errCodeInvalidFormat, part,
+				"некорректная часть правила RRULE: %s", part.text)
+		}
+		name := strings.ToUpper(nameText)
+		val := ruleToken{strings.ToUpper(valText), part.pos + len(nameText) + 1}
+		if _, ok := seen[name]; ok {
+			return nil, newRepeatError(errCodeDuplicatePart, part,
+				"повторяющаяся часть правила RRULE: %s", name)
+		}
+		seen[name] = part
+
+		var err error
+		switch name {
+		case "FREQ":
+			switch val.text {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				r.freq = val.text
+				r.freqTok = part
+			default:
+				err = newRepeatError(errCodeUnsupported, val,
+					"неподдерживаемая частота RRULE: %s", val.text)
+			}
+		case "INTERVAL":
+			r.interval, err = parseRRuleInt(name, val, 1, 1000)
+		case "COUNT":
+			r.count, err = parseRRuleInt(name, val, 1, 10000)
+			r.limitTok = part
+		case "UNTIL":
+			r.until, err = parseRRuleUntil(val)
+			r.limitTok = part
+		case "BYDAY":
+			r.byDay, err = parseRRuleByDay(val)
+		case "BYMONTHDAY":
+			for _, item := range val.split(",") {
+				var day int
+				day, err = parseRRuleInt(name, item, -31, 31)
+				if err == nil && day == 0 {
+					err = newRepeatError(errCodeInvalidValue, item,
+						"некорректное значение BYMONTHDAY: %s", item.text)
+				}
+				if err != nil {
+					break
+				}
+				r.byMonthDay = append(r.byMonthDay, day)
+			}
+		case "BYMONTH":
+			for _, item := range val.split(",") {
+				var month int
+				month, err = parseRRuleInt(name, item, 1, 12)
+				if err != nil {
+					break
+				}
+				r.byMonth = append(r.byMonth, time.Month(month))
+			}
+		case "WKST":
+			wd, ok := rruleWeekdays[val.text]
+			if !ok {
+				err = newRepeatError(errCodeInvalidValue, val,
+					"некорректное значение WKST: %s", val.text)
+			}
+			r.wkst = wd
+		default:
+			err = newRepeatError(errCodeUnsupported, part,
+				"неподдерживаемая часть правила RRULE: %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.freq == "" {
+		return nil, newRepeatError(errCodeInvalidFormat, ruleToken{pos: value.pos},
+			"в правиле RRULE не указан FREQ")
+	}
+	if _, ok := seen["COUNT"]; ok {
+		if until, ok := seen["UNTIL"]; ok {
+			return nil, newRepeatError(errCodeConflict, until,
+				"COUNT и UNTIL нельзя указывать вместе")
+		}
+	}
+	if r.freq == "WEEKLY" && len(r.byMonthDay) > 0 {
+		return nil, newRepeatError(errCodeConflict, seen["BYMONTHDAY"],
+			"BYMONTHDAY нельзя использовать с FREQ=WEEKLY")
+	}
+	for _, wn := range r.byDay {
+		if wn.ord == 0 {
+			continue
+		}
+		// Порядковые номера допустимы только в пределах месяца или года
+		maxOrd := 5
+		switch {
+		case r.freq == "YEARLY" && len(r.byMonth) == 0:
+			maxOrd = 53
+		case r.freq != "MONTHLY" && r.freq != "YEARLY":
+			return nil, newRepeatError(errCodeConflict, wn.tok,
+				"порядковый номер в BYDAY допустим только для MONTHLY и YEARLY")
+		}
+		if wn.ord > maxOrd || wn.ord < -maxOrd {
+			return nil, newRepeatError(errCodeInvalidValue, wn.tok,
+				"некорректный порядковый номер в BYDAY: %s", wn.tok.text)
+		}
+	}
+	return r, nil
+}
+
+func parseRRuleInt(name string, val ruleToken, min, max int) (int, error) {
+	n, err := strconv.Atoi(val.text)
+	if err != nil || n < min || n > max {
+		return 0, newRepeatError(errCodeInvalidValue, val,
+			"некорректное значение %s: %s", name, val.text)
+	}
+	return n, nil
+}
+
+// parseRRuleUntil принимает UNTIL как дату или дату со временем; время
+// отбрасывается, так как задачи планируются с точностью до дня.
+func parseRRuleUntil(val ruleToken) (time.Time, error) {
+	datePart, _, _ := strings.Cut(val.text, "T")
+	until, err := time.Parse("20060102", datePart)
+	if err != nil {
+		return time.Time{}, newRepeatError(errCodeInvalidValue, val,
+			"некорректное значение UNTIL: %s", val.text)
+	}
+	return until, nil
+}
+
+func parseRRuleByDay(val ruleToken) ([]weekdayNum, error) {
+	var days []weekdayNum
+	for _, item := range val.split(",") {
+		text := item.text
+		if len(text) < 2 {
+			return nil, newRepeatError(errCodeInvalidValue, item,
+				"некорректное значение BYDAY: %s", text)
+		}
+		wd, ok := rruleWeekdays[text[len(text)-2:]]
+		if !ok {
+			return nil, newRepeatError(errCodeInvalidValue, item,
+				"некорректное значение BYDAY: %s", text)
+		}
+		wn := weekdayNum{weekday: wd, tok: item}
+		if ordStr := text[:len(text)-2]; ordStr != "" {
+			ord, err := strconv.Atoi(ordStr)
+			if err != nil || ord == 0 {
+				return nil, newRepeatError(errCodeInvalidValue, item,
+					"некорректное значение BYDAY: %s", text)
+			}
+			wn.ord = ord
+		}
+		days = append(days, wn)
+	}
+	return days, nil
+}
+
+// next возвращает первое повторение строго после from. start — DTSTART,
+// первая дата серии: с неё начинается отсчёт INTERVAL и COUNT.
+func (r *rrule) next(start, from time.Time) (time.Time, error) {
+	// Сколько периодов после from просматривать, прежде чем сдаться:
+	// 29 февраля может не встречаться до 8 лет подряд.
+	limit := map[string]int{"DAILY": 366 * 9, "WEEKLY": 53 * 9, "MONTHLY": 12 * 9, "YEARLY": 9}[r.freq]
+
+	n := 0
+	period := r.periodStart(start)
+	if r.count == 0 {
+		// Без COUNT повторения до from считать не нужно: сразу переходим к
+		// последнему периоду сетки INTERVAL, который начинается не позже from
+		period = r.shiftPeriod(period, r.periodsBetween(period, r.periodStart(from))/r.interval)
+	}
+	for passed := 0; passed <= limit; {
+		for _, date := range r.expand(period, start) {
+			if date.Before(start) {
+				continue
+			}
+			if !r.until.IsZero() && date.After(r.until) {
+				return time.Time{}, newRepeatError(errCodeNoOccurrences, r.limitTok,
+					"по правилу RRULE больше нет повторений")
+			}
+			n++
+			if r.count > 0 && n > r.count {
+				return time.Time{}, newRepeatError(errCodeNoOccurrences, r.limitTok,
+					"по правилу RRULE больше нет повторений")
+			}
+			if date.After(from) {
+				return date, nil
+			}
+		}
+		period = r.shiftPeriod(period, 1)
+		if period.After(from) {
+			passed++
+		}
+	}
+	return time.Time{}, newRepeatError(errCodeNoOccurrences, r.freqTok,
+		"по правилу RRULE не найдено ни одного повторения")
+}
+
+// periodStart возвращает начало периода (дня, недели, месяца или года),
+// которому принадлежит date.
+func (r *rrule) periodStart(date time.Time) time.Time {
+	switch r.freq {
+	case "WEEKLY":
+		offset := (int(date.Weekday()) - int(r.wkst) + 7) % 7
+		return date.AddDate(0, 0, -offset)
+	case "MONTHLY":
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case "YEARLY":
+		return time.Date(date.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return date
+}
+
+// shiftPeriod сдвигает начало периода на steps интервалов INTERVAL.
+func (r *rrule) shiftPeriod(period time.Time, steps int) time.Time {
+	switch r.freq {
+	case "WEEKLY":
+		return period.AddDate(0, 0, 7*steps*r.interval)
+	case "MONTHLY":
+		return period.AddDate(0, steps*r.interval, 0)
+	case "YEARLY":
+		return period.AddDate(steps*r.interval, 0, 0)
+	}
+	return period.AddDate(0, 0, steps*r.interval)
+}
+
+// periodsBetween возвращает число периодов частоты FREQ между началами
+// периодов from и to.
+func (r *rrule) periodsBetween(from, to time.Time) int {
+	switch r.freq {
+	case "WEEKLY":
+		return daysBetween(from, to) / 7
+	case "MONTHLY":
+		return (to.Year()-from.Year())*12 + int(to.Month()-from.Month())
+	case "YEARLY":
+		return to.Year() - from.Year()
+	}
+	return daysBetween(from, to)
+}
+
+// expand возвращает упорядоченные даты периода, подходящие под правило.
+func (r *rrule) expand(period, start time.Time) []time.Time {
+	var dates []time.Time
+	switch r.freq {
+	case "DAILY":
+		if r.matchMonth(period.Month()) && r.matchMonthDay(period) &&
+			r.matchDay(period, period, period) {
+			dates = append(dates, period)
+		}
+	case "WEEKLY":
+		for i := 0; i < 7; i++ {
+			date := period.AddDate(0, 0, i)
+			if len(r.byDay) == 0 && date.Weekday() != start.Weekday() {
+				continue
+			}
+			if r.matchDay(date, date, date) && r.matchMonth(date.Month()) {
+				dates = append(dates, date)
+			}
+		}
+	case "MONTHLY":
+		if r.matchMonth(period.Month()) {
+			dates = r.expandMonth(period.Year(), period.Month(), start)
+		}
+	case "YEARLY":
+		year := period.Year()
+		switch {
+		case len(r.byMonth) == 0 && len(r.byMonthDay) == 0 && len(r.byDay) > 0:
+			// Порядковые номера BYDAY считаются от начала и конца года
+			first := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+			last := time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC)
+			for date := first; !date.After(last); date = date.AddDate(0, 0, 1) {
+				if r.matchDay(date, first, last) {
+					dates = append(dates, date)
+				}
+			}
+		case len(r.byMonth) == 0 && len(r.byMonthDay) == 0:
+			// Без уточнений — ежегодно в день и месяц даты задачи
+			if date, ok := monthDayDate(year, start.Month(), start.Day(), r.overflow); ok {
+				dates = append(dates, date)
+			}
+		default:
+			for month := time.January; month <= time.December; month++ {
+				if r.matchMonth(month) {
+					dates = append(dates, r.expandMonth(year, month, start)...)
+				}
+			}
+		}
+	}
+	return dates
+}
+
+// expandMonth раскрывает BYMONTHDAY и BYDAY в пределах одного месяца.
+func (r *rrule) expandMonth(year int, month time.Month, start time.Time) []time.Time {
+	var dates []time.Time
+	lastDay := lastDayOfMonth(year, month)
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	last := time.Date(year, month, lastDay, 0, 0, 0, 0, time.UTC)
+
+	if len(r.byMonthDay) == 0 && len(r.byDay) == 0 {
+		if date, ok := monthDayDate(year, month, start.Day(), r.overflow); ok {
+			dates = append(dates, date)
+		}
+		return dates
+	}
+	for date := first; !date.After(last); date = date.AddDate(0, 0, 1) {
+		if r.matchMonthDay(date) && r.matchDay(date, first, last) {
+			dates = append(dates, date)
+		}
+	}
+	return dates
+}
+
+func (r *rrule) matchMonth(month time.Month) bool {
+	if len(r.byMonth) == 0 {
+		return true
+	}
+	for _, m := range r.byMonth {
+		if m == month {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rrule) matchMonthDay(date time.Time) bool {
+	if len(r.byMonthDay) == 0 {
+		return true
+	}
+	lastDay := lastDayOfMonth(date.Year(), date.Month())
+	for _, day := range r.byMonthDay {
+		if day == date.Day() || day < 0 && lastDay+1+day == date.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDay проверяет BYDAY; порядковые номера считаются в пределах
+// промежутка от first до last.
+func (r *rrule) matchDay(date, first, last time.Time) bool {
+	if len(r.byDay) == 0 {
+		return true
+	}
+	for _, wn := range r.byDay {
+		if wn.matches(date, first, last) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches проверяет, что date — нужный день недели с нужным порядковым
+// номером в промежутке от first до last.
+func (wn weekdayNum) matches(date, first, last time.Time) bool {
+	if wn.weekday != date.Weekday() {
+		return false
+	}
+	switch {
+	case wn.ord > 0:
+		return daysBetween(first, date)/7+1 == wn.ord
+	case wn.ord < 0:
+		return daysBetween(date, last)/7+1 == -wn.ord
+	}
+	return true
+}
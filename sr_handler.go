@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Интервальное повторение по алгоритму SM-2: правило "sr" или "sr <лёгкость>".
+// Следующий интервал зависит от оценок качества, с которыми задачу отмечали
+// выполненной: чем легче даётся повторение, тем реже оно назначается.
+const (
+	srDefaultEase = 2.5
+	srMinEase     = 1.3
+	srMaxEase     = 5.0
+	// Интервал растёт экспоненциально, поэтому ограничен десятью годами
+	srMaxInterval = 3650
+	// Оценка качества повторения: 0 — полностью забыто, 5 — идеально
+	srMinQuality = 0
+	srMaxQuality = 5
+)
+
+// parseSpacedRule разбирает правило "sr" с необязательной начальной
+// лёгкостью (ease factor) от 1.3 до 5.
+func parseSpacedRule(repeat string, fields []ruleToken) (float64, error) {
+	if err := checkRuleFields(repeat, fields, 1, 2); err != nil {
+		return 0, err
+	}
+	if len(fields) == 1 {
+		return srDefaultEase, nil
+	}
+	ease, err := strconv.ParseFloat(fields[1].text, 64)
+	if err != nil || ease < srMinEase || ease > srMaxEase {
+		return 0, newRepeatError(errCodeInvalidValue, fields[1],
+			"лёгкость в правиле 'sr' должна быть от 1.3 до 5: %s", fields[1].text)
+	}
+	return ease, nil
+}
+
+// spacedInterval возвращает число дней до следующего повторения после
+// оценок grades (от первой к последней) и лёгкость, с которой правило
+// подошло к последней оценке. Без оценок интервал — один день.
+func spacedInterval(ease float64, grades []int) (int, float64) {
+	interval, streak := 1, 0
+	for _, q := range grades {
+		// Неудачное повторение начинает серию заново, лёгкость при этом
+		// всё равно снижается
+		switch {
+		case q < 3:
+			streak, interval = 0, 1
+		case streak == 0:
+			streak, interval = 1, 1
+		case streak == 1:
+			streak, interval = 2, 6
+		default:
+			streak++
+			interval = min(int(math.Round(float64(interval)*ease)), srMaxInterval)
+		}
+		d := float64(srMaxQuality - q)
+		ease = max(ease+0.1-d*(0.08+d*0.02), srMinEase)
+	}
+	return interval, ease
+}
+
+// isQuality проверяет оценку качества повторения.
+func isQuality(q int) bool {
+	return q >= srMinQuality && q <= srMaxQuality
+}
+
+// parseGrades разбирает список оценок через запятую: "5,4,3".
+func parseGrades(list string) ([]int, bool) {
+	var grades []int
+	for _, s := range strings.Split(list, ",") {
+		q, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || !isQuality(q) {
+			return nil, false
+		}
+		grades = append(grades, q)
+	}
+	return grades, true
+}
+
+// isSpacedRule сообщает, что правило — интервальное повторение.
+func isSpacedRule(repeat string) bool {
+	fields := ruleFields(repeat)
+	return len(fields) > 0 && fields[0].text == "sr"
+}
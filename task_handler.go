@@ -0,0 +1,228 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// taskHandler обслуживает /api/task: GET ?id= возвращает задачу, POST
+// создаёт, PUT заменяет задачу из тела запроса, DELETE ?id= удаляет.
+func taskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	switch r.Method {
+	case http.MethodGet:
+		getTask(w, r, db)
+	case http.MethodPost:
+		createTask(w, r, db)
+	case http.MethodPut:
+		updateTask(w, r, db)
+	case http.MethodDelete:
+		deleteTask(w, r, db)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Метод не разрешен")
+	}
+}
+
+// prepareTask проверяет задачу перед сохранением и приводит её дату к
+// виду, в котором она хранится: прошедшая дата разовой задачи становится
+// сегодняшней, повторяющейся — ближайшим повторением. Указанная дата
+// становится началом серии повторений, если оно ещё не задано. Возвращает
+// HTTP-статус ошибки; ошибки правила повторения — *RepeatError. old —
+// сохранённая версия изменяемой задачи, при создании nil.
+func prepareTask(db *sql.DB, task *Task, old *Task) (int, error) {
+	if strings.TrimSpace(task.Title) == "" {
+		return http.StatusBadRequest, errors.New("Не указан заголовок задачи")
+	}
+	if task.Time != "" {
+		if _, err := time.Parse("15:04", task.Time); err != nil {
+			return http.StatusBadRequest, errors.New("Некорректный формат времени")
+		}
+	}
+	if task.Anchor != "" && task.Anchor != anchorSchedule && task.Anchor != anchorCompletion {
+		return http.StatusBadRequest, errors.New("Якорь повторения должен быть schedule или completion")
+	}
+	if !isOverflowPolicy(task.Overflow) {
+		return http.StatusBadRequest, errors.New("Политика overflow должна быть forward, clamp или skip")
+	}
+	if !isCatchupPolicy(task.Catchup) {
+		return http.StatusBadRequest, errors.New("Политика catchup должна быть skip, one или each")
+	}
+	loc, err := taskLocation(task.TZ)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	// "Сегодня" определяется в часовом поясе задачи
+	taskNow := time.Now().In(loc)
+	now := taskNow.Format("20060102")
+
+	if task.Date == "" {
+		task.Date = now
+	} else {
+		parsedDate, err := time.Parse("20060102", task.Date)
+		if err != nil {
+			return http.StatusBadRequest, errors.New("Некорректный формат даты")
+		}
+
+		if parsedDate.Format("20060102") < now {
+			if strings.TrimSpace(task.Repeat) == "" {
+				task.Date = now
+			}
+		}
+	}
+	if task.Start == "" {
+		task.Start = task.Date
+	}
+	if len(task.Repeat) > maxRepeatLength {
+		return http.StatusBadRequest, newRepeatError(errCodeInvalidFormat,
+			ruleToken{task.Repeat[maxRepeatLength:], maxRepeatLength},
+			"правило повторения длиннее %d символов", maxRepeatLength)
+	}
+	if trigger, _, _, ok := afterRule(task.Repeat); ok {
+		// Дату зависимой задаче назначит выполнение задачи trigger
+		if trigger == task.ID {
+			return http.StatusBadRequest, errors.New("Задача не может зависеть от самой себя")
+		}
+		if old != nil && old.Repeat == task.Repeat {
+			// Правило не изменилось: назначенная дата остаётся, а задача
+			// trigger могла быть уже выполнена и удалена
+			task.Date, task.Start = old.Date, old.Start
+			return http.StatusOK, nil
+		}
+		exists, err := taskExistsInDB(db, fmt.Sprint(trigger))
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if !exists {
+			return http.StatusBadRequest, fmt.Errorf("Задача %d, от которой зависит задача, не найдена", trigger)
+		}
+		task.Date = ""
+	} else if strings.TrimSpace(task.Repeat) != "" {
+		// Правило проверяется через NextDate; прошедшая дата переносится
+		// на ближайшее повторение
+		nextDate, err := NextDateWith(taskNow, task.Date, task.Repeat,
+			RepeatOptions{Overflow: task.Overflow, Start: task.Start})
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		if task.Date < now {
+			task.Date = nextDate
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// writeTaskError отвечает ошибкой prepareTask: ошибка правила повторения —
+// с её кодом и позицией, остальные — с кодом по статусу.
+func writeTaskError(w http.ResponseWriter, status int, err error) {
+	var repeatErr *RepeatError
+	if errors.As(err, &repeatErr) {
+		writeRepeatError(w, err)
+		return
+	}
+	writeError(w, status, err.Error())
+}
+
+// getTask возвращает задачу по id вместе с описанием правила повторения.
+func getTask(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "Не указан идентификатор задачи")
+		return
+	}
+	task, err := getTaskFromDB(db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "Задача не найдена")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if task.Repeat != "" {
+		task.RepeatText, _ = DescribeRepeat(task.Repeat)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(task)
+}
+
+// updateTask заменяет задачу с id из тела запроса. Проверки те же, что при
+// создании; даты-исключения и история выполнения сохраняются, а отменённая
+// дата переносится на следующее повторение. Новая дата или новое правило
+// начинают серию повторений заново.
+func updateTask(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	var task Task
+	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
+		writeError(w, http.StatusBadRequest, "Некорректный JSON или идентификатор задачи")
+		return
+	}
+	if task.ID == 0 {
+		writeError(w, http.StatusBadRequest, "Не указан идентификатор задачи")
+		return
+	}
+	old, err := getTaskFromDB(db, strconv.FormatInt(task.ID, 10))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, "Задача не найдена")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if task.Date == old.Date && task.Repeat == old.Repeat {
+		task.Start = old.Start
+	}
+	if status, err := prepareTask(db, &task, &old); err != nil {
+		writeTaskError(w, status, err)
+		return
+	}
+	exdates, err := getExdatesFromDB(db, strconv.FormatInt(task.ID, 10))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := skipExcludedDate(&task, exdates); err != nil {
+		writeTaskError(w, http.StatusBadRequest, err)
+		return
+	}
+	updated, err := updateTaskInDB(db, task)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !updated {
+		writeError(w, http.StatusNotFound, "Задача не найдена")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(struct{}{})
+}
+
+// deleteTask удаляет задачу по id. Задачу, выполнения которой ждут другие
+// задачи, удалить нельзя: сначала нужно изменить их правило или удалить их.
+func deleteTask(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "Не указан идентификатор задачи")
+		return
+	}
+	deleted, err := deleteTaskFromDB(db, id)
+	if errors.Is(err, errTaskAwaited) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !deleted {
+		writeError(w, http.StatusNotFound, "Задача не найдена")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(struct{}{})
+}
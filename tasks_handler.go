@@ -0,0 +1,219 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tasksLimit — наибольшее число записей на странице /api/tasks, задаётся
+// переменной TODO_TASKS_LIMIT.
+var tasksLimit = 50
+
+// taskCursor — место, с которого начинается следующая страница списка:
+// ключ сортировки и id последней задачи. Клиенту передаётся непрозрачной
+// строкой; порядок и поиск в ней нужны, чтобы курсор не применили к
+// другому списку.
+type taskCursor struct {
+	Sort   string `json:"s"`
+	Search string `json:"q,omitempty"`
+	Key    string `json:"k,omitempty"`
+	ID     int64  `json:"id"`
+}
+
+func (c taskCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeTaskCursor(s string) (*taskCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("Некорректный курсор")
+	}
+	var c taskCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errors.New("Некорректный курсор")
+	}
+	return &c, nil
+}
+
+// tasksHandler обслуживает GET /api/tasks: задачи постранично, не больше
+// limit записей (по умолчанию и не больше tasksLimit) на странице.
+//
+// sort — порядок: date (по умолчанию; задачи без даты, ждущие выполнения
+// другой задачи, идут в конце), title или created. Если есть следующая
+// страница, в ответе есть next_cursor; его передают параметром cursor.
+// Параметр search в виде 02.01.2006 отбирает задачи на эту дату, любой
+// другой — задачи, в заголовке или комментарии которых есть эта строка без
+// учёта регистра.
+func tasksHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Метод не разрешен")
+		return
+	}
+	query := r.URL.Query()
+	search := strings.TrimSpace(query.Get("search"))
+
+	q := taskListQuery{Sort: query.Get("sort"), Limit: tasksLimit}
+	switch q.Sort {
+	case "":
+		q.Sort = sortDate
+	case sortDate, sortTitle, sortCreated:
+	default:
+		writeError(w, http.StatusBadRequest, "Параметр sort должен быть date, title или created")
+		return
+	}
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > tasksLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Параметр limit должен быть от 1 до %d", tasksLimit))
+			return
+		}
+		q.Limit = limit
+	}
+	if s := query.Get("cursor"); s != "" {
+		cursor, err := decodeTaskCursor(s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if cursor.Sort != q.Sort || cursor.Search != search {
+			writeError(w, http.StatusBadRequest, "Курсор относится к другому списку: изменились sort или search")
+			return
+		}
+		q.After = cursor
+	}
+
+	var matchDate func(string) bool
+	if search != "" {
+		if date, err := time.Parse("02.01.2006", search); err == nil {
+			day := date.Format("20060102")
+			// Просроченная задача с политикой each может выпасть на эту дату
+			// одним из пропущенных повторений
+			q.Until = day
+			q.Match = func(task Task) bool {
+				return task.Date == day || task.Catchup == catchupEach
+			}
+			matchDate = func(date string) bool { return date == day }
+		} else {
+			text := strings.ToLower(search)
+			q.Match = func(task Task) bool {
+				return strings.Contains(strings.ToLower(task.Title), text) ||
+					strings.Contains(strings.ToLower(task.Comment), text)
+			}
+		}
+	}
+
+	// limit ограничивает число записей, а не задач: поиск по дате отбрасывает
+	// записи на другие дни, а задача с политикой each даёт несколько. Записи
+	// одной задачи не делятся между страницами; если их у задачи больше
+	// limit, показываются первые limit, остальные — после их выполнения.
+	// Задачи читаются порциями, пока страница не заполнится; курсор
+	// указывает на последнюю задачу, попавшую на страницу.
+	limit := q.Limit
+	q.Limit++
+	entries := make([]Task, 0)
+	var next *taskCursor
+	for {
+		tasks, err := listTasksFromDB(db, q)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		full := false
+		for _, task := range tasks {
+			taskEntries, err := listEntries(db, task, matchDate)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if len(taskEntries) == 0 {
+				continue
+			}
+			if len(entries)+len(taskEntries) > limit && len(entries) > 0 {
+				full = true
+				break
+			}
+			if len(taskEntries) > limit {
+				taskEntries = taskEntries[:limit]
+			}
+			entries = append(entries, taskEntries...)
+			next = newTaskCursor(q.Sort, search, task)
+		}
+		if full {
+			break
+		}
+		if len(tasks) < q.Limit {
+			// Задачи закончились: следующей страницы нет
+			next = nil
+			break
+		}
+		q.After = newTaskCursor(q.Sort, search, tasks[len(tasks)-1])
+	}
+
+	resp := map[string]any{"tasks": entries}
+	if next != nil {
+		resp["next_cursor"] = next.encode()
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// newTaskCursor возвращает курсор, следующая страница после которого
+// начинается за задачей task.
+func newTaskCursor(sort, search string, task Task) *taskCursor {
+	cursor := &taskCursor{Sort: sort, Search: search, ID: task.ID}
+	switch sort {
+	case sortDate:
+		cursor.Key = task.Date
+	case sortTitle:
+		cursor.Key = task.Title
+	}
+	return cursor
+}
+
+// listEntries возвращает записи задачи в списке. Для политики each каждое
+// пропущенное повторение — отдельная запись; записи одной задачи идут
+// подряд с места её даты. Непустая matchDate оставляет только записи на
+// искомую дату, кроме отменённых.
+func listEntries(db *sql.DB, task Task, matchDate func(string) bool) ([]Task, error) {
+	if task.Repeat != "" {
+		task.RepeatText, _ = DescribeRepeat(task.Repeat)
+	}
+	dates := []string{task.Date}
+	if task.Date == "" || task.Catchup != catchupEach && matchDate == nil {
+		return []Task{task}, nil
+	}
+	exdates, err := getExdatesFromDB(db, strconv.FormatInt(task.ID, 10))
+	if err != nil {
+		return nil, err
+	}
+	if task.Catchup == catchupEach {
+		loc, err := taskLocation(task.TZ)
+		if err != nil {
+			loc = serverLocation
+		}
+		dates = overdueDates(time.Now().In(loc), task, exdates)
+	}
+	excluded := make(map[string]bool, len(exdates))
+	for _, exdate := range exdates {
+		excluded[exdate] = true
+	}
+	entries := make([]Task, 0, len(dates))
+	for _, date := range dates {
+		if matchDate != nil && (!matchDate(date) || excluded[date]) {
+			continue
+		}
+		entry := task
+		entry.Date = date
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
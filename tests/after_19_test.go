@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskAfter(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	_, err := requestJSON("api/task", map[string]any{"title": "Доставка мебели"}, http.MethodPost)
+	assert.NoError(t, err)
+	var delivery Task
+	err = db.Get(&delivery, `SELECT * FROM scheduler WHERE title = ?`, "Доставка мебели")
+	assert.NoError(t, err)
+
+	// Зависимая задача сохраняется без даты, даже если дата указана
+	_, err = requestJSON("api/task", map[string]any{
+		"title":  "Оплатить счёт за мебель",
+		"date":   time.Now().Format(`20060102`),
+		"repeat": fmt.Sprintf("after %d 5", delivery.ID),
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	var invoice Task
+	err = db.Get(&invoice, `SELECT * FROM scheduler WHERE title = ?`, "Оплатить счёт за мебель")
+	assert.NoError(t, err)
+	assert.Equal(t, "", invoice.Date)
+
+	// Задачи без даты не попадают в календарь
+	now := time.Now()
+	body, err := requestJSON(fmt.Sprintf("api/calendar?from=%s&to=%s",
+		now.Format(`20060102`), now.AddDate(0, 0, 30).Format(`20060102`)), nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(body), "Оплатить счёт за мебель")
+
+	_, err = requestJSON("api/task", map[string]any{
+		"title":  "Зависит от несуществующей",
+		"repeat": "after 999999999 1",
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	var task Task
+	err = db.Get(&task, `SELECT * FROM scheduler WHERE title = ?`, "Зависит от несуществующей")
+	assert.Error(t, err)
+
+	for _, v := range []repeatError{
+		{"after 12 5", "no_occurrences", "12", 6},
+		{"after 0 5", "invalid_value", "0", 6},
+		{"after 12 -1", "invalid_value", "-1", 9},
+		{"after 12 401", "invalid_value", "401", 9},
+		{"after 12", "invalid_format", "", 8},
+	} {
+		body, err := getBody("api/nextdate?now=20240126&date=20240126&repeat=" + url.QueryEscape(v.repeat))
+		assert.NoError(t, err)
+		var m map[string]any
+		assert.NoError(t, json.Unmarshal(body, &m), v.repeat)
+		assert.Equal(t, v.code, m["code"], v.repeat)
+		if v.token != "" {
+			assert.Equal(t, v.token, m["token"], v.repeat)
+		}
+		assert.Equal(t, v.position, m["position"], v.repeat)
+	}
+
+	assert.Equal(t, "через 5 дней после выполнения задачи 12", describeRepeat(t, "after 12 5")["text"])
+	assert.Equal(t, "в день выполнения задачи 12", describeRepeat(t, "after 12 0")["text"])
+}
+
+func TestDoneAfter(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	ret, err := postJSON("api/task", map[string]any{"title": "Принять поставку"}, http.MethodPost)
+	assert.NoError(t, err)
+	id, ok := ret["id"]
+	if !assert.True(t, ok, "не возвращён id: %v", ret) {
+		return
+	}
+	ret, err = postJSON("api/task", map[string]any{
+		"title":  "Оплатить поставку",
+		"repeat": fmt.Sprintf("after %v 5", id),
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	depID := ret["id"]
+
+	ret, err = postJSON("api/task/done?id="+fmt.Sprint(id), nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+
+	var task Task
+	err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, depID)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Now().AddDate(0, 0, 5).Format(`20060102`), task.Date)
+
+	// Изменение задачи без смены правила сохраняет назначенную дату, хотя
+	// разовой задачи, от которой она зависела, уже нет
+	ret, err = postJSON("api/task", map[string]any{
+		"id":     depID,
+		"title":  "Оплатить поставку до обеда",
+		"repeat": fmt.Sprintf("after %v 5", id),
+	}, http.MethodPut)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, depID)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Now().AddDate(0, 0, 5).Format(`20060102`), task.Date)
+	assert.Equal(t, "Оплатить поставку до обеда", task.Title)
+
+	// Разовой задачи, от которой зависела задача, больше нет: ждать нечего,
+	// и выполненная зависимая задача удаляется
+	ret, err = postJSON("api/task/done?id="+fmt.Sprint(depID), nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	notFoundTask(t, fmt.Sprint(depID))
+
+	// Зависимая задача повторяющейся задачи после выполнения снова ждёт
+	ret, err = postJSON("api/task", map[string]any{
+		"title":  "Провести инвентаризацию",
+		"repeat": "d 30",
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	id = ret["id"]
+	ret, err = postJSON("api/task", map[string]any{
+		"title":  "Списать испорченное",
+		"repeat": fmt.Sprintf("after %v 1", id),
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	depID = ret["id"]
+	for _, taskID := range []any{id, depID} {
+		ret, err = postJSON("api/task/done?id="+fmt.Sprint(taskID), nil, http.MethodPost)
+		assert.NoError(t, err)
+		assert.Empty(t, ret)
+	}
+	err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, depID)
+	assert.NoError(t, err)
+	assert.Equal(t, "", task.Date)
+
+	// Задачу, которую ждут другие задачи, удалить нельзя
+	ret, err = postJSON("api/task", map[string]any{
+		"title":  "Отчитаться о списании",
+		"repeat": fmt.Sprintf("after %v 2", depID),
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	chainID := ret["id"]
+	for _, v := range []struct{ id, waiting any }{{id, depID}, {depID, chainID}} {
+		ret, err = postJSON("api/task?id="+fmt.Sprint(v.id), nil, http.MethodDelete)
+		assert.NoError(t, err)
+		assert.Equal(t, "conflict", ret["code"], ret)
+		assert.Equal(t, float64(http.StatusConflict), ret["status"], ret)
+		// В ошибке перечислены ждущие задачи
+		assert.Contains(t, ret["error"], fmt.Sprint(v.waiting))
+		err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, v.id)
+		assert.NoError(t, err)
+	}
+	// Удалять можно от конца цепочки
+	for _, taskID := range []any{chainID, depID, id} {
+		ret, err = postJSON("api/task?id="+fmt.Sprint(taskID), nil, http.MethodDelete)
+		assert.NoError(t, err)
+		assert.Empty(t, ret)
+		notFoundTask(t, fmt.Sprint(taskID))
+	}
+}
@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskAnchor(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	for _, v := range []struct {
+		anchor string
+		code   string
+	}{
+		{"", ""},
+		{"schedule", ""},
+		{"completion", ""},
+		{"yesterday", "bad_request"},
+		{"Completion", "bad_request"},
+	} {
+		task, ok := createTask(t, db, map[string]any{
+			"title":  "Полить цветы",
+			"repeat": "d 3",
+			"anchor": v.anchor,
+		}, v.code)
+		if ok {
+			assert.Equal(t, v.anchor, task.Anchor)
+		}
+	}
+}
+
+func TestDoneAnchor(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	for _, anchor := range []string{"schedule", "completion"} {
+		ret, err := postJSON("api/task", map[string]any{
+			"title":  "Проверить якорь " + anchor,
+			"date":   now.Format(`20060102`),
+			"repeat": "d 3",
+			"anchor": anchor,
+		}, http.MethodPost)
+		assert.NoError(t, err)
+		id, ok := ret["id"]
+		if !assert.True(t, ok, "не возвращён id: %v", ret) {
+			continue
+		}
+
+		// Задача выполняется три раза в один и тот же день: по расписанию
+		// она уходит всё дальше, от дня выполнения — остаётся через 3 дня
+		for i := 1; i <= 3; i++ {
+			ret, err := postJSON("api/task/done?id="+fmt.Sprint(id), nil, http.MethodPost)
+			assert.NoError(t, err)
+			assert.Empty(t, ret)
+
+			var task Task
+			err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+			assert.NoError(t, err)
+			want := now.AddDate(0, 0, 3)
+			if anchor == "schedule" {
+				want = now.AddDate(0, 0, 3*i)
+			}
+			assert.Equal(t, want.Format(`20060102`), task.Date, anchor)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendar(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	for _, v := range []map[string]any{
+		{"title": "Календарь: планёрка", "date": "20310106", "repeat": "w 1"},
+		{"title": "Календарь: врач", "date": "20310115", "time": "09:00"},
+		{"title": "Календарь: отчёт", "date": "20310131", "repeat": "m 31", "overflow": "clamp"},
+		{"title": "Календарь: зарядка", "date": "20310226", "repeat": "d 2", "time": "07:30"},
+	} {
+		_, err := requestJSON("api/task", v, http.MethodPost)
+		assert.NoError(t, err)
+	}
+	var meetingID int64
+	err := db.Get(&meetingID, `SELECT id FROM scheduler WHERE title = ?`, "Календарь: планёрка")
+	assert.NoError(t, err)
+	_, err = requestJSON(fmt.Sprintf("api/task/exdate?id=%d&date=20310113", meetingID), nil, http.MethodPost)
+	assert.NoError(t, err)
+
+	body, err := requestJSON("api/calendar?from=20310101&to=20310305", nil, http.MethodGet)
+	assert.NoError(t, err)
+	var calendar struct {
+		Days []struct {
+			Date  string              `json:"date"`
+			Tasks []map[string]string `json:"tasks"`
+		} `json:"days"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &calendar), string(body))
+
+	got := make(map[string][]string)
+	prev := ""
+	for _, day := range calendar.Days {
+		assert.Less(t, prev, day.Date, "дни должны идти по порядку")
+		prev = day.Date
+		for _, task := range day.Tasks {
+			assert.Equal(t, day.Date, task["date"])
+			got[task["title"]] = append(got[task["title"]], day.Date)
+		}
+	}
+	assert.Equal(t, []string{"20310106", "20310120", "20310127", "20310203",
+		"20310210", "20310217", "20310224", "20310303"}, got["Календарь: планёрка"])
+	assert.Equal(t, []string{"20310115"}, got["Календарь: врач"])
+	assert.Equal(t, []string{"20310131", "20310228"}, got["Календарь: отчёт"])
+	assert.Equal(t, []string{"20310226", "20310228", "20310302", "20310304"}, got["Календарь: зарядка"])
+
+	// 28 февраля задача без времени идёт раньше зарядки в 07:30
+	for _, day := range calendar.Days {
+		if day.Date == "20310228" {
+			var titles []string
+			for _, task := range day.Tasks {
+				if task["title"] == "Календарь: отчёт" || task["title"] == "Календарь: зарядка" {
+					titles = append(titles, task["title"])
+				}
+			}
+			assert.Equal(t, []string{"Календарь: отчёт", "Календарь: зарядка"}, titles)
+			break
+		}
+	}
+
+	// Окно, начинающееся позже даты задачи, начинается с ближайшего повторения
+	body, err = requestJSON("api/calendar?from=20310208&to=20310214", nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(body, &calendar))
+	found := false
+	for _, day := range calendar.Days {
+		for _, task := range day.Tasks {
+			if task["title"] == "Календарь: планёрка" {
+				assert.Equal(t, "20310210", day.Date)
+				assert.Equal(t, "по понедельникам", task["repeat_text"])
+				found = true
+			}
+		}
+	}
+	assert.True(t, found)
+
+	// Отменённая дата не показывается, даже если задача на ней осталась
+	res, err := db.Exec(`INSERT INTO scheduler (date, title, comment, repeat) VALUES ('20320105', ?, '', 'w 1')`,
+		"Календарь: отменённая планёрка")
+	assert.NoError(t, err)
+	id, err := res.LastInsertId()
+	assert.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO exdates (task_id, date) VALUES (?, '20320105')`, id)
+	assert.NoError(t, err)
+	body, err = requestJSON("api/calendar?from=20320101&to=20320120", nil, http.MethodGet)
+	assert.NoError(t, err)
+	calendar.Days = nil
+	assert.NoError(t, json.Unmarshal(body, &calendar))
+	var dates []string
+	for _, day := range calendar.Days {
+		for _, task := range day.Tasks {
+			if task["title"] == "Календарь: отменённая планёрка" {
+				dates = append(dates, day.Date)
+			}
+		}
+	}
+	assert.Equal(t, []string{"20320112", "20320119"}, dates)
+
+	for _, query := range []string{"from=20310101", "from=20310301&to=20310101",
+		"from=20310101&to=20330101", "from=2031-01-01&to=20310201"} {
+		m, err := postJSON("api/calendar?"+query, nil, http.MethodGet)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, m["error"], query)
+	}
+}
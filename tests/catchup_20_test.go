@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskCatchup(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	for _, v := range []struct {
+		catchup string
+		code    string
+	}{
+		{"", ""},
+		{"skip", ""},
+		{"one", ""},
+		{"each", ""},
+		{"all", "bad_request"},
+	} {
+		task, ok := createTask(t, db, map[string]any{
+			"title":   "Зарядка",
+			"repeat":  "d 1",
+			"catchup": v.catchup,
+		}, v.code)
+		if ok {
+			assert.Equal(t, v.catchup, task.Catchup)
+		}
+	}
+}
+
+func TestDoneCatchup(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	// Просроченную задачу нельзя создать через API: дата в прошлом сразу
+	// переносится на ближайшее повторение
+	now := time.Now()
+	overdue := now.AddDate(0, 0, -14).Format(`20060102`)
+	for _, v := range []struct {
+		catchup string
+		want    []string
+	}{
+		{"", []string{now.AddDate(0, 0, 1).Format(`20060102`)}},
+		{"skip", []string{now.AddDate(0, 0, 1).Format(`20060102`)}},
+		{"one", []string{now.AddDate(0, 0, -13).Format(`20060102`), now.AddDate(0, 0, -12).Format(`20060102`)}},
+		{"each", []string{now.AddDate(0, 0, -13).Format(`20060102`), now.AddDate(0, 0, -12).Format(`20060102`)}},
+	} {
+		res, err := db.Exec(`INSERT INTO scheduler (date, title, comment, repeat, catchup) VALUES (?, ?, '', 'd 1', ?)`,
+			overdue, "Пропущенная зарядка "+v.catchup, v.catchup)
+		assert.NoError(t, err)
+		id, err := res.LastInsertId()
+		assert.NoError(t, err)
+
+		for _, want := range v.want {
+			ret, err := postJSON(fmt.Sprintf("api/task/done?id=%d", id), nil, http.MethodPost)
+			assert.NoError(t, err)
+			assert.Empty(t, ret)
+
+			var task Task
+			err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+			assert.NoError(t, err)
+			assert.Equal(t, want, task.Date, v.catchup)
+			if v.catchup == "" || v.catchup == "skip" {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextDateCron(t *testing.T) {
+	for _, v := range []struct {
+		repeat string
+		want   string
+	}{
+		{"cron 0 9 * * 1-5", "20240129"},
+		{"cron 0 9 * * *", "20240127"},
+		{"cron 0 9 * * 7", "20240128"},
+		{"cron 0 9 * * SUN", "20240128"},
+		{"cron 30 8 1,15 * *", "20240201"},
+		{"cron 0 0 13 * 5", "20240202"},
+		{"cron 0 0 13 * *", "20240213"},
+		{"cron 0 0 29 2 *", "20240229"},
+		{"cron 0 0 * JAN,FEB MON", "20240129"},
+		{"cron */15 * */10 * *", "20240131"},
+		{"cron 0 12 5/10 * *", "20240205"},
+		{"cron 0 9 1 jun-aug *", "20240601"},
+		{"cron 0 9 27 * * +b", "20240129"},
+	} {
+		urlPath := fmt.Sprintf("api/nextdate?now=20240126&date=20240126&repeat=%s", url.QueryEscape(v.repeat))
+		body, err := getBody(urlPath)
+		assert.NoError(t, err)
+		assert.Equal(t, v.want, strings.TrimSpace(string(body)), v.repeat)
+	}
+
+	for _, v := range []repeatError{
+		{"cron 0 25 * * *", "invalid_value", "25", 7},
+		{"cron 0 9 * *", "invalid_format", "", 12},
+		{"cron 0 9 * * 1 5", "invalid_format", "5", 15},
+		{"cron 0 9 32 * *", "invalid_value", "32", 9},
+		{"cron 0 9 * 1,13 *", "invalid_value", "13", 13},
+		{"cron 0 9 * * 5-1", "invalid_value", "5-1", 13},
+		{"cron */0 * * * *", "invalid_value", "*/0", 5},
+		{"cron 0 9 * XYZ *", "invalid_value", "XYZ", 11},
+		{"cron 0 0 31 2 *", "no_occurrences", "31", 9},
+	} {
+		urlPath := fmt.Sprintf("api/nextdate?now=20240126&date=20240126&repeat=%s", url.QueryEscape(v.repeat))
+		body, err := getBody(urlPath)
+		assert.NoError(t, err)
+		var m map[string]any
+		assert.NoError(t, json.Unmarshal(body, &m), v.repeat)
+		assert.Equal(t, v.code, m["code"], v.repeat)
+		if v.token != "" {
+			assert.Equal(t, v.token, m["token"], v.repeat)
+		}
+		assert.Equal(t, v.position, m["position"], v.repeat)
+		assert.Contains(t, m["error"], "cron", v.repeat)
+	}
+
+	// Слишком длинное правило отклоняется до записи в базу
+	long := "cron 0 9 " + strings.Repeat("1,", 60) + "2 * *"
+	m, err := postJSON("api/task", map[string]any{"title": "Длинный cron", "repeat": long}, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Equal(t, "invalid_format", m["code"])
+	assert.Equal(t, float64(128), m["position"])
+}
@@ -11,11 +11,17 @@ import (
 )
 
 type Task struct {
-	ID      int64  `db:"id"`
-	Date    string `db:"date"`
-	Title   string `db:"title"`
-	Comment string `db:"comment"`
-	Repeat  string `db:"repeat"`
+	ID       int64  `db:"id"`
+	Date     string `db:"date"`
+	Title    string `db:"title"`
+	Comment  string `db:"comment"`
+	Repeat   string `db:"repeat"`
+	Time     string `db:"time"`
+	TZ       string `db:"tz"`
+	Anchor   string `db:"anchor"`
+	Overflow string `db:"overflow"`
+	Catchup  string `db:"catchup"`
+	Start    string `db:"start"`
 }
 
 func count(db *sqlx.DB) (int, error) {
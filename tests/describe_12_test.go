@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func describeRepeat(t *testing.T, repeat string) map[string]any {
+	m, err := postJSON("api/repeat/describe", map[string]any{"repeat": repeat}, http.MethodPost)
+	assert.NoError(t, err)
+	return m
+}
+
+func TestRepeatDescribe(t *testing.T) {
+	for _, v := range []struct {
+		repeat string
+		text   string
+	}{
+		{"d 1", "каждый день"},
+		{"d 3", "каждые 3 дня"},
+		{"d 21", "каждые 3 недели"},
+		{"d 31", "каждый 31 день"},
+		{"d 45", "каждые 45 дней"},
+		{"y", "каждый год"},
+		{"w 1,4", "по понедельникам и четвергам"},
+		{"w 5,1,3", "по понедельникам, средам и пятницам"},
+		{"w 1,2,3,4,5", "по будням"},
+		{"m -1", "в последний день месяца"},
+		{"m -1,15 1,4,7,10", "15-го и в последний день месяца, в январе, апреле, июле и октябре"},
+		{"m 1,15", "1-го и 15-го числа"},
+		{"n 2:2", "во второй вторник месяца"},
+		{"n 1:1,-1:5 3", "в первый понедельник и последнюю пятницу месяца, в марте"},
+		{"b 1", "каждый рабочий день"},
+		{"b 5", "каждые 5 рабочих дней"},
+		{"w 1 +b", "по понедельникам, с переносом на рабочий день"},
+		{"m 1 !h", "1-го числа, кроме праздников"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=FR", "каждые 2 недели по пятницам"},
+		{"RRULE:FREQ=MONTHLY;BYDAY=-1FR;COUNT=10", "каждый месяц, в последнюю пятницу месяца, 10 раз"},
+		{"FREQ=YEARLY;BYMONTH=5;BYMONTHDAY=9;UNTIL=20300101", "каждый год, 9-го числа, в мае, до 01.01.2030"},
+		{"FREQ=DAILY;UNTIL=20000101", "каждый день, до 01.01.2000"},
+	} {
+		m := describeRepeat(t, v.repeat)
+		assert.Equal(t, v.text, m["text"], "%q: %v", v.repeat, m)
+	}
+
+	body, err := getBody("api/repeat/describe?repeat=" + url.QueryEscape("d 7"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "каждую неделю")
+
+	m := describeRepeat(t, "m 32")
+	assert.Equal(t, "invalid_value", m["code"])
+	assert.Equal(t, "32", m["token"])
+	m = describeRepeat(t, "")
+	assert.Equal(t, "empty_rule", m["code"])
+}
+
+// Описание правила, полученного из фразы, разбирается обратно в то же
+// правило.
+func TestRepeatRoundTrip(t *testing.T) {
+	for _, phrase := range []string{
+		"каждый день",
+		"каждые 3 дня",
+		"каждые 2 недели",
+		"каждую неделю по понедельникам",
+		"по понедельникам и четвергам",
+		"по будням",
+		"по выходным",
+		"каждые 2 недели по понедельникам и пятницам",
+		"по вторникам в январе и июле",
+		"последний день месяца",
+		"1 и 15 числа, кроме праздников",
+		"15-го, в предпоследний и в последний день месяца, в январе, апреле, июле и октябре",
+		"во второй вторник месяца",
+		"в первый понедельник, вторую среду и последнее воскресенье марта",
+		"в третий с конца четверг месяца",
+		"каждый месяц",
+		"каждые 3 месяца",
+		"каждые 3 месяца 15-го числа",
+		"каждые 2 месяца в последнюю пятницу",
+		"каждый год",
+		"каждые 2 года",
+		"каждый рабочий день",
+		"каждые 21 рабочий день",
+		"каждые 3 рабочих дня, с переносом после праздников",
+		"по субботам с переносом на рабочий день",
+		"каждые 10 дней, кроме нерабочих дней",
+		"every 2 weeks on Friday",
+		"last day of the month",
+	} {
+		repeat := parseRepeat(t, phrase)["repeat"]
+		if !assert.NotNil(t, repeat, phrase) {
+			continue
+		}
+		text := describeRepeat(t, repeat.(string))["text"]
+		if !assert.NotNil(t, text, "%s → %s", phrase, repeat) {
+			continue
+		}
+		assert.Equal(t, repeat, parseRepeat(t, text.(string))["repeat"], "%s → %s → %s", phrase, repeat, text)
+	}
+}
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoneConcurrent(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	today := now.Format(`20060102`)
+	id := addTask(t, task{
+		date:   today,
+		title:  "Выполнить одновременно",
+		repeat: "d 3",
+	})
+
+	// Клиенты отмечают задачу одновременно; возвращается число успешных
+	// запросов, остальные должны получить 409
+	const clients = 8
+	completeAll := func(query string) int {
+		var wg sync.WaitGroup
+		rets := make([]map[string]any, clients)
+		for i := 0; i < clients; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				ret, err := postJSON("api/task/done?"+query, nil, http.MethodPost)
+				if assert.NoError(t, err) {
+					rets[i] = ret
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		succeeded := 0
+		for _, ret := range rets {
+			if ret["error"] == nil {
+				succeeded++
+			} else {
+				assert.Equal(t, "conflict", ret["code"], ret)
+			}
+		}
+		return succeeded
+	}
+
+	// Несколько клиентов отмечают одну и ту же дату: задача переносится
+	// только один раз, остальные получают ошибку
+	assert.Equal(t, 1, completeAll(fmt.Sprintf("id=%s&date=%s", id, today)))
+	var task Task
+	err := db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, now.AddDate(0, 0, 3).Format(`20060102`), task.Date)
+
+	// Без даты каждый запрос — отдельное выполнение текущего повторения:
+	// ни одно не теряется и ни одно не переносит задачу дважды
+	succeeded := completeAll("id=" + id)
+	assert.GreaterOrEqual(t, succeeded, 1)
+	err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, now.AddDate(0, 0, 3*(1+succeeded)).Format(`20060102`), task.Date)
+
+	for _, path := range []string{"api/task/done", "api/task/done?id=abc", "api/task/done?id=7645346343"} {
+		ret, err := postJSON(path, nil, http.MethodPost)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, ret["error"], path)
+	}
+}
+
+func TestDoneSpaced(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	id := addTask(t, task{
+		title:  "Повторить слова",
+		repeat: "sr",
+	})
+
+	// Интервалы SM-2 при оценках 5, 5, 5: 1, 6 и 16 дней от дня выполнения
+	for _, days := range []int{1, 6, 16} {
+		ret, err := postJSON("api/task/done?id="+id+"&quality=5", nil, http.MethodPost)
+		assert.NoError(t, err)
+		assert.Empty(t, ret)
+
+		var task Task
+		err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+		assert.NoError(t, err)
+		assert.Equal(t, now.AddDate(0, 0, days).Format(`20060102`), task.Date)
+	}
+
+	// Неудачное повторение начинает серию заново; оценка передаётся и в теле
+	ret, err := postJSON("api/task/done?id="+id, map[string]any{"quality": 1}, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	var task Task
+	err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, now.AddDate(0, 0, 1).Format(`20060102`), task.Date)
+
+	var reviews int
+	err = db.Get(&reviews, `SELECT count(*) FROM reviews WHERE task_id=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, reviews)
+
+	for _, quality := range []string{"6", "-1", "хорошо"} {
+		ret, err := postJSON("api/task/done?id="+id+"&quality="+quality, nil, http.MethodPost)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, ret["error"], quality)
+	}
+}
+
+func TestDoneCount(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	id := addTask(t, task{
+		date:   now.Format(`20060102`),
+		title:  "Принять таблетку",
+		repeat: "FREQ=DAILY;COUNT=3",
+	})
+
+	// COUNT считается от первой даты серии, а не от текущей даты задачи
+	ret, err := postJSON("api/task/done?id="+id, nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	var task Task
+	err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, now.AddDate(0, 0, 1).Format(`20060102`), task.Date)
+
+	// Правка заголовка не начинает серию заново
+	ret, err = postJSON("api/task", map[string]any{
+		"id":     id,
+		"date":   task.Date,
+		"title":  "Принять таблетку после еды",
+		"repeat": task.Repeat,
+	}, http.MethodPut)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+
+	ret, err = postJSON("api/task/done?id="+id, nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+	assert.NoError(t, err)
+	assert.Equal(t, now.AddDate(0, 0, 2).Format(`20060102`), task.Date)
+
+	// Третье повторение последнее: после него задача удаляется
+	ret, err = postJSON("api/task/done?id="+id, nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, ret)
+	notFoundTask(t, id)
+}
@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorEnvelope(t *testing.T) {
+	for _, v := range []struct {
+		method string
+		path   string
+		status int
+		code   string
+	}{
+		{http.MethodGet, "api/nextdate", http.StatusBadRequest, "bad_request"},
+		{http.MethodGet, "api/nextdate?now=20240126&repeat=d%201", http.StatusBadRequest, "bad_request"},
+		{http.MethodGet, "api/nextdate?now=2024-01-26&date=20240126&repeat=d%201", http.StatusBadRequest, "bad_request"},
+		{http.MethodGet, "api/nextdate?now=20240126&date=2024-01-26&repeat=d%201", http.StatusBadRequest, "bad_request"},
+		{http.MethodGet, "api/nextdate?now=20240126&date=20240230&repeat=d%201", http.StatusBadRequest, "bad_request"},
+		{http.MethodGet, "api/nextdate?now=20240126&date=20240126&repeat=d%20401", http.StatusBadRequest, "invalid_value"},
+		{http.MethodGet, "api/task", http.StatusBadRequest, "bad_request"},
+		{http.MethodGet, "api/task?id=99999999", http.StatusNotFound, "not_found"},
+		{http.MethodPatch, "api/task", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{http.MethodPost, "api/tasks", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{http.MethodPost, "api/task", http.StatusBadRequest, "bad_request"},
+	} {
+		req, err := http.NewRequest(v.method, getURL(v.path), nil)
+		assert.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.NoError(t, err)
+
+		msg := v.method + " " + v.path
+		assert.Equal(t, v.status, resp.StatusCode, msg)
+		assert.Contains(t, resp.Header.Get("Content-Type"), "application/json", msg)
+		// Тело — один JSON-объект, без второго ответа после ошибки
+		var m map[string]any
+		if assert.NoError(t, json.Unmarshal(body, &m), msg+": "+string(body)) {
+			assert.NotEmpty(t, m["error"], msg)
+			assert.Equal(t, v.code, m["code"], msg)
+			assert.Equal(t, float64(v.status), m["status"], msg)
+			if v.code == "invalid_value" {
+				// У ошибки правила есть позиция ошибочного фрагмента
+				assert.Equal(t, float64(2), m["position"], msg)
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExdates(t *testing.T) {
+	// Отменённые понедельники пропускаются, в том числе несколько подряд
+	for _, v := range []struct {
+		exdate string
+		want   string
+	}{
+		{"", "20240129"},
+		{"20240129", "20240205"},
+		{"20240129,20240205", "20240212"},
+		{"20240129&exdate=20240205", "20240212"},
+		{"20240122", "20240129"},
+	} {
+		urlPath := "api/nextdate?now=20240126&date=20240101&repeat=w%201"
+		if v.exdate != "" {
+			urlPath += "&exdate=" + v.exdate
+		}
+		body, err := getBody(urlPath)
+		assert.NoError(t, err)
+		assert.Equal(t, v.want, strings.TrimSpace(string(body)), v.exdate)
+	}
+	body, err := getBody("api/nextdate?now=20240126&date=20240101&repeat=w%201&count=3&exdate=20240205")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `["20240129","20240212","20240219"]`, string(body))
+
+	body, err = requestJSON("api/task", map[string]any{
+		"title":  "Планёрка",
+		"repeat": "w 1",
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	var ret map[string]string
+	assert.NoError(t, json.Unmarshal(body, &ret), string(body))
+	id := ret["id"]
+
+	for _, date := range []string{"20310106", "20310113", "20310106"} {
+		m, err := postJSON("api/task/exdate?id="+id+"&date="+date, nil, http.MethodPost)
+		assert.NoError(t, err)
+		assert.Empty(t, m)
+	}
+	m, err := postJSON("api/task/exdate?id="+id, nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"20310106", "20310113"}, m["exdates"])
+
+	m, err = postJSON("api/task/exdate?id="+id+"&date=20310106", nil, http.MethodDelete)
+	assert.NoError(t, err)
+	assert.Empty(t, m)
+	m, err = postJSON("api/task/exdate?id="+id, nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"20310113"}, m["exdates"])
+
+	// Задача, текущая дата которой отменена, переходит на следующий
+	// понедельник — и при добавлении исключения, и при изменении даты
+	id = addTask(t, task{"20320105", "Планёрка", "", "w 1"})
+	m, err = postJSON("api/task/exdate?id="+id+"&date=20320105", nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, m)
+	m, err = postJSON("api/task?id="+id, nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.Equal(t, "20320112", m["date"])
+
+	m, err = postJSON("api/task/exdate?id="+id+"&date=20320119", nil, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Empty(t, m)
+	m, err = postJSON("api/task?id="+id, nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.Equal(t, "20320112", m["date"])
+	m, err = postJSON("api/task", map[string]any{
+		"id":     id,
+		"date":   "20320119",
+		"title":  "Планёрка",
+		"repeat": "w 1",
+	}, http.MethodPut)
+	assert.NoError(t, err)
+	assert.Empty(t, m)
+	m, err = postJSON("api/task?id="+id, nil, http.MethodGet)
+	assert.NoError(t, err)
+	assert.Equal(t, "20320126", m["date"])
+
+	for _, v := range []struct {
+		url    string
+		method string
+	}{
+		{"api/task/exdate?id=" + id + "&date=20310106", http.MethodDelete},
+		{"api/task/exdate?id=" + id + "&date=06.01.2031", http.MethodPost},
+		{"api/task/exdate?date=20310106", http.MethodPost},
+		{"api/task/exdate?id=99999999", http.MethodGet},
+	} {
+		m, err := postJSON(v.url, nil, v.method)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, m["error"], "%s %s", v.method, v.url)
+	}
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var gridBase = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func apiNextDate(t *testing.T, now, date time.Time, repeat string) (time.Time, bool) {
+	urlPath := fmt.Sprintf("api/nextdate?now=%s&date=%s&repeat=%s",
+		now.Format(`20060102`), date.Format(`20060102`), url.QueryEscape(repeat))
+	body, err := getBody(urlPath)
+	assert.NoError(t, err)
+	next, err := time.Parse(`20060102`, strings.TrimSpace(string(body)))
+	if !assert.NoError(t, err, "%s %s %q: %s", now.Format(`20060102`),
+		date.Format(`20060102`), repeat, body) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+func gridFrom(now, date time.Time) time.Time {
+	if now.After(date) {
+		return now
+	}
+	return date
+}
+
+func gridDays(from, to time.Time) int {
+	return int(to.Sub(from).Hours() / 24)
+}
+
+// checkFirstAfter проверяет, что next — первая дата после from, для которой
+// match возвращает true.
+func checkFirstAfter(t *testing.T, from, next time.Time, match func(time.Time) bool, msg string) {
+	assert.True(t, next.After(from), "%s: %s не позже %s", msg, next, from)
+	assert.True(t, match(next), "%s: %s не попадает в правило", msg, next)
+	for d := from.AddDate(0, 0, 1); d.Before(next); d = d.AddDate(0, 0, 1) {
+		if match(d) {
+			t.Errorf("%s: пропущена дата %s перед %s", msg, d, next)
+			return
+		}
+	}
+}
+
+func TestNextDateGrid(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randDate := func() time.Time {
+		return gridBase.AddDate(0, 0, rnd.Intn(365*30))
+	}
+
+	for i := 0; i < 100; i++ {
+		date, now := randDate(), randDate()
+		from := gridFrom(now, date)
+
+		// d N: дата на сетке date + k*N и первая после from
+		n := rnd.Intn(400) + 1
+		repeat := fmt.Sprintf("d %d", n)
+		if next, ok := apiNextDate(t, now, date, repeat); ok {
+			assert.Zero(t, gridDays(date, next)%n, repeat)
+			assert.True(t, next.After(from), repeat)
+			assert.False(t, next.AddDate(0, 0, -n).After(from), repeat)
+		}
+
+		// y: тот же день и месяц, первый год после from
+		if next, ok := apiNextDate(t, now, date, "y"); ok {
+			if date.Month() != time.February || date.Day() != 29 {
+				assert.Equal(t, date.Month(), next.Month())
+				assert.Equal(t, date.Day(), next.Day())
+			}
+			assert.True(t, next.After(from))
+			assert.False(t, next.AddDate(-1, 0, 0).After(from))
+		}
+
+		// w: выбранный день недели, ближайший после from
+		var weekdays []string
+		inWeek := map[time.Weekday]bool{}
+		for wd := 1; wd <= 7; wd++ {
+			if rnd.Intn(3) == 0 {
+				weekdays = append(weekdays, fmt.Sprint(wd))
+				inWeek[time.Weekday(wd%7)] = true
+			}
+		}
+		if len(weekdays) > 0 {
+			repeat = "w " + strings.Join(weekdays, ",")
+			if next, ok := apiNextDate(t, now, date, repeat); ok {
+				checkFirstAfter(t, from, next, func(d time.Time) bool {
+					return inWeek[d.Weekday()]
+				}, repeat)
+			}
+		}
+
+		// m: выбранный день месяца, ближайший после from
+		monthDay := rnd.Intn(33) - 2
+		if monthDay == 0 {
+			monthDay = 31
+		}
+		repeat = fmt.Sprintf("m %d", monthDay)
+		if next, ok := apiNextDate(t, now, date, repeat); ok {
+			checkFirstAfter(t, from, next, func(d time.Time) bool {
+				last := time.Date(d.Year(), d.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+				return d.Day() == monthDay || monthDay < 0 && d.Day() == last+1+monthDay
+			}, repeat)
+		}
+
+		// RRULE: каждые k недель по понедельникам, считая от недели date
+		k := rnd.Intn(5) + 1
+		repeat = fmt.Sprintf("FREQ=WEEKLY;INTERVAL=%d;BYDAY=MO", k)
+		weekStart := date.AddDate(0, 0, -(int(date.Weekday())+6)%7)
+		if next, ok := apiNextDate(t, now, date, repeat); ok {
+			checkFirstAfter(t, from, next, func(d time.Time) bool {
+				return d.Weekday() == time.Monday && !d.Before(date) &&
+					(gridDays(weekStart, d)/7)%k == 0
+			}, repeat)
+		}
+	}
+}
+
+func FuzzNextDateDays(f *testing.F) {
+	f.Add(uint16(0), uint16(0), uint16(1))
+	f.Add(uint16(100), uint16(5000), uint16(7))
+	f.Add(uint16(9000), uint16(20), uint16(400))
+	f.Add(uint16(365), uint16(366), uint16(30))
+	f.Fuzz(func(t *testing.T, dateOffset, nowOffset, interval uint16) {
+		n := int(interval)%400 + 1
+		date := gridBase.AddDate(0, 0, int(dateOffset)%(365*50))
+		now := gridBase.AddDate(0, 0, int(nowOffset)%(365*50))
+		from := gridFrom(now, date)
+
+		repeat := fmt.Sprintf("d %d", n)
+		next, ok := apiNextDate(t, now, date, repeat)
+		if !ok {
+			return
+		}
+		assert.Zero(t, gridDays(date, next)%n, repeat)
+		assert.True(t, next.After(from), repeat)
+		assert.False(t, next.AddDate(0, 0, -n).After(from), repeat)
+	})
+}
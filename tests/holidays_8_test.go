@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const holidaysICS = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20310101\r\n" +
+	"DTEND;VALUE=DATE:20310109\r\n" +
+	"SUMMARY:Новогодние\r\n  каникулы\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20310111\r\n" +
+	"SUMMARY:Рабочая суббота\r\n" +
+	"CATEGORIES:WORKDAY\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+const holidaysCSV = `дата;название
+23.02.2031;День защитника Отечества
+20310308;Международный женский день
+`
+
+func postHolidays(t *testing.T, data string) map[string]any {
+	resp, err := http.Post(getURL("api/holidays"), "text/plain", bytes.NewBufferString(data))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	var m map[string]any
+	assert.NoError(t, json.Unmarshal(body, &m))
+	return m
+}
+
+func TestHolidays(t *testing.T) {
+	m := postHolidays(t, holidaysICS)
+	assert.Equal(t, float64(9), m["imported"])
+	m = postHolidays(t, holidaysCSV)
+	assert.Equal(t, float64(2), m["imported"])
+	m = postHolidays(t, "не дата,праздник\nи это не дата,тоже\n")
+	assert.NotEmpty(t, m["error"])
+
+	body, err := requestJSON("api/holidays?from=20310101&to=20311231", nil, http.MethodGet)
+	assert.NoError(t, err)
+	var list map[string][]map[string]any
+	assert.NoError(t, json.Unmarshal(body, &list))
+	assert.Len(t, list["holidays"], 11)
+	for _, h := range list["holidays"] {
+		if h["date"] == "20310101" {
+			assert.Equal(t, "Новогодние каникулы", h["title"])
+		}
+		assert.Equal(t, h["date"] == "20310111", h["workday"])
+	}
+
+	tbl := []struct {
+		now    string
+		repeat string
+		want   string
+	}{
+		{"20301231", "b 1", "20310109"},
+		{"20301231", "b 3", "20310111"},
+		{"20301231", "m 1 +h", "20310109"},
+		{"20301231", "m 1 !h", "20310201"},
+		{"20301231", "m 1 !b", "20310401"},
+		{"20310301", "w 6 !h", "20310315"},
+		{"20310301", "w 6 +b", "20310310"},
+	}
+	for _, v := range tbl {
+		get, err := getBody(fmt.Sprintf("api/nextdate?now=%s&date=%s&repeat=%s",
+			v.now, v.now, url.QueryEscape(v.repeat)))
+		assert.NoError(t, err)
+		assert.Equal(t, v.want, strings.TrimSpace(string(get)), v.repeat)
+	}
+}
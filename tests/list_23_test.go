@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTasksSearch(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	_, err := db.Exec("DELETE FROM scheduler")
+	assert.NoError(t, err)
+
+	bread := addTask(t, task{title: "Купить ХЛЕБ", comment: "Бородинский"})
+	addTask(t, task{title: "Забрать посылку", comment: "Пункт выдачи у дома"})
+	_, err = requestJSON("api/task", map[string]any{
+		"title":  "Оплатить хлебозавод",
+		"repeat": "after " + bread + " 2",
+	}, http.MethodPost)
+	assert.NoError(t, err)
+
+	// Поиск по заголовку и комментарию без учёта регистра кириллицы
+	tasks := getTasks(t, "хлеб")
+	assert.Len(t, tasks, 2)
+	tasks = getTasks(t, "БОРОДИН")
+	assert.Len(t, tasks, 1)
+	tasks = getTasks(t, "выдачи")
+	assert.Len(t, tasks, 1)
+
+	// Задача без даты идёт в конце списка
+	tasks = getTasks(t, "")
+	if assert.Len(t, tasks, 3) {
+		assert.Equal(t, "Оплатить хлебозавод", tasks[2]["title"])
+		assert.Equal(t, "", tasks[2]["date"])
+	}
+
+	// Пропущенные повторения задачи с политикой each — отдельные записи
+	_, err = db.Exec(`INSERT INTO scheduler (date, title, comment, repeat, catchup) VALUES (?, ?, '', 'd 1', 'each')`,
+		now.AddDate(0, 0, -3).Format(`20060102`), "Пропущенная пробежка")
+	assert.NoError(t, err)
+	var dates []string
+	for _, task := range getTasks(t, "пробежка") {
+		dates = append(dates, task["date"])
+	}
+	assert.Equal(t, []string{
+		now.AddDate(0, 0, -3).Format(`20060102`),
+		now.AddDate(0, 0, -2).Format(`20060102`),
+		now.AddDate(0, 0, -1).Format(`20060102`),
+		now.Format(`20060102`),
+	}, dates)
+	tasks = getTasks(t, now.AddDate(0, 0, -2).Format(`02.01.2006`))
+	if assert.Len(t, tasks, 1) {
+		assert.Equal(t, "Пропущенная пробежка", tasks[0]["title"])
+	}
+
+	// Число записей в ответе ограничено; четыре записи пропущенной
+	// пробежки считаются отдельно
+	for i := 0; i < 60; i++ {
+		_, err = db.Exec(`INSERT INTO scheduler (date, title, comment, repeat) VALUES (?, ?, '', '')`,
+			now.AddDate(0, 0, i).Format(`20060102`), fmt.Sprintf("Задача %d", i))
+		assert.NoError(t, err)
+	}
+	body, err := requestJSON("api/tasks", nil, http.MethodGet)
+	assert.NoError(t, err)
+	var page struct {
+		Tasks      []map[string]string `json:"tasks"`
+		NextCursor string              `json:"next_cursor"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &page))
+	ids := make(map[string]bool)
+	for i, task := range page.Tasks {
+		ids[task["id"]] = true
+		if i > 0 {
+			assert.LessOrEqual(t, page.Tasks[i-1]["date"], task["date"])
+		}
+	}
+	assert.Len(t, page.Tasks, 50)
+	assert.Len(t, ids, 47)
+	assert.NotEmpty(t, page.NextCursor)
+
+	_, err = db.Exec("DELETE FROM scheduler")
+	assert.NoError(t, err)
+}
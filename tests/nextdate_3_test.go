@@ -1,7 +1,9 @@
 package tests
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
 	"testing"
@@ -36,6 +38,58 @@ func TestNextDate(t *testing.T) {
 		{"20240320", "d 401", ""},
 		{"20231225", "d 12", `20240130`},
 		{"20240228", "d 1", "20240229"},
+		{"20240126", "w", ""},
+		{"20240126", "w 0", ""},
+		{"20240126", "w 1,,2", ""},
+		{"20240126", "w 1,4,7", "20240128"},
+		{"20240201", "w 1", "20240205"},
+		{"20240110", "w 5", "20240202"},
+		{"20240126", "FREQ=DAILY", "20240127"},
+		{"20240101", "FREQ=DAILY;INTERVAL=10", "20240131"},
+		{"20240101", "FREQ=DAILY;COUNT=3", ""},
+		{"20240101", "FREQ=DAILY;UNTIL=20240127", "20240127"},
+		{"20240101", "FREQ=DAILY;UNTIL=20240126T235959Z", ""},
+		{"20240101", "FREQ=DAILY;COUNT=2;UNTIL=20240301", ""},
+		{"20240101", "FREQ=WEEKLY;BYDAY=MO,TH", "20240129"},
+		{"20240101", "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU", "20240130"},
+		{"20240101", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,SU", "20240129"},
+		{"20240101", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,SU;WKST=SU", "20240128"},
+		{"20240101", "FREQ=WEEKLY;BYDAY=1MO", ""},
+		{"20240101", "RRULE:FREQ=MONTHLY;BYDAY=-1FR", "20240223"},
+		{"20240101", "FREQ=MONTHLY;BYDAY=2TU", "20240213"},
+		{"20240101", "freq=monthly;bymonthday=-1", "20240131"},
+		{"20240131", "FREQ=MONTHLY", "20240331"},
+		{"20240101", "FREQ=YEARLY;BYMONTH=3;BYDAY=1MO", "20240304"},
+		{"20200229", "FREQ=YEARLY", "20240229"},
+		{"20240101", "FREQ=HOURLY", ""},
+		{"20240101", "INTERVAL=2", ""},
+		{"20240101", "FREQ=MONTHLY;BYMONTHDAY=0", ""},
+		{"20240126", "b 1", "20240129"},
+		{"20240122", "b 3", "20240130"},
+		{"20240126", "b 0", ""},
+		{"20240126", "b", ""},
+		{"20240126", "m 10 +b", "20240212"},
+		{"20240126", "d 1 +b", "20240129"},
+		{"20240126", "d 5 +b", "20240131"},
+		{"20240101", "FREQ=MONTHLY;BYMONTHDAY=10 +b", "20240212"},
+		{"20240126", "+b", ""},
+		{"20240126", "b 2 +b +b", ""},
+		{"20240101", "n -1:5", "20240223"},
+		{"20240101", "n 2:2", "20240213"},
+		{"20240101", "n 1:1 3", "20240304"},
+		{"20240126", "n 5:4", "20240229"},
+		{"20240301", "n 5:4 2", "20520229"},
+		{"20240126", "n -1:4 2", "20240229"},
+		{"20250101", "n -1:4 2", "20250227"},
+		{"20240126", "n -5:1", "20240401"},
+		{"20240126", "n 1:1,-1:7 1,2", "20240128"},
+		{"20240126", "n", ""},
+		{"20240126", "n 1", ""},
+		{"20240126", "n 0:1", ""},
+		{"20240126", "n 6:1", ""},
+		{"20240126", "n 1:8", ""},
+		{"20240126", "n 1:1,", ""},
+		{"20240126", "n 1:1 13", ""},
 	}
 	check := func() {
 		for _, v := range tbl {
@@ -70,6 +124,12 @@ func TestNextDate(t *testing.T) {
 		{"20240222", "m -2,-3", ""},
 		{"20240326", "m -1,-2", "20240330"},
 		{"20240201", "m -1,18", "20240218"},
+		{"20240126", "m 31 2,4", ""},
+		{"20240126", "m 30 2,4", "20240430"},
+		{"20240126", "m 29 2", "20240229"},
+		{"20240301", "m 29 2", "20280229"},
+		{"20240126", "m 1 13", ""},
+		{"20240126", "m 1 1 1", ""},
 		{"20240125", "w 1,2,3", "20240129"},
 		{"20240126", "w 7", "20240128"},
 		{"20230126", "w 4,5", "20240201"},
@@ -77,3 +137,83 @@ func TestNextDate(t *testing.T) {
 	}
 	check()
 }
+
+type nextDates struct {
+	date   string
+	repeat string
+	params string
+	want   []string
+}
+
+func TestNextDates(t *testing.T) {
+	tbl := []nextDates{
+		{"20240126", "w 1,4", "count=4", []string{"20240129", "20240201", "20240205", "20240208"}},
+		{"20240126", "d 10", "until=20240301", []string{"20240205", "20240215", "20240225"}},
+		{"20240126", "m -1", "count=5&until=20240430", []string{"20240131", "20240229", "20240331", "20240430"}},
+		{"20240101", "FREQ=DAILY;UNTIL=20240129", "count=10", []string{"20240127", "20240128", "20240129"}},
+		{"20240125", "FREQ=DAILY;COUNT=3", "count=6", []string{"20240127"}},
+		{"20240126", "w 8", "count=3", nil},
+		{"20240126", "d 1", "count=0", nil},
+		{"20240126", "d 1", "count=1000", nil},
+		{"20240126", "d 1", "until=2024", nil},
+	}
+	for _, v := range tbl {
+		urlPath := fmt.Sprintf("api/nextdate?now=20240126&date=%s&repeat=%s&%s",
+			url.QueryEscape(v.date), url.QueryEscape(v.repeat), v.params)
+		body, err := getBody(urlPath)
+		assert.NoError(t, err)
+		var dates []string
+		err = json.Unmarshal(body, &dates)
+		if v.want == nil {
+			assert.Error(t, err, `{%q, %q, %q}`, v.date, v.repeat, v.params)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, v.want, dates, `{%q, %q, %q}`, v.date, v.repeat, v.params)
+	}
+}
+
+type repeatError struct {
+	repeat   string
+	code     string
+	token    string
+	position float64
+}
+
+func TestNextDateErrors(t *testing.T) {
+	tbl := []repeatError{
+		{"", "empty_rule", "", 0},
+		{"k 34", "unknown_rule", "k", 0},
+		{"d", "invalid_format", "", 1},
+		{"d 7 7", "invalid_format", "7", 4},
+		{"d 401", "invalid_value", "401", 2},
+		{"w 1,9", "invalid_value", "9", 4},
+		{"m 1 13", "invalid_value", "13", 4},
+		{"FREQ=DAILY;BYDAY=MO,XX", "invalid_value", "XX", 20},
+		{"FREQ=DAILY;COUNT=1", "no_occurrences", "COUNT=1", 11},
+	}
+	for _, v := range tbl {
+		urlPath := fmt.Sprintf("api/nextdate?now=20240126&date=20240101&repeat=%s",
+			url.QueryEscape(v.repeat))
+		body, err := getBody(urlPath)
+		assert.NoError(t, err)
+		var m map[string]any
+		err = json.Unmarshal(body, &m)
+		assert.NoError(t, err, v.repeat)
+		assert.NotEmpty(t, m["error"], v.repeat)
+		assert.Equal(t, v.code, m["code"], v.repeat)
+		if len(v.token) > 0 {
+			assert.Equal(t, v.token, m["token"], v.repeat)
+		}
+		assert.Equal(t, v.position, m["position"], v.repeat)
+	}
+
+	m, err := postJSON("api/task", map[string]any{
+		"date":   "20240126",
+		"title":  "Заголовок",
+		"repeat": "w 1,9",
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	assert.Equal(t, "invalid_value", m["code"])
+	assert.Equal(t, "9", m["token"])
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextDateOverflow(t *testing.T) {
+	for _, v := range []struct {
+		date, now, repeat, overflow string
+		want                        string
+	}{
+		{"20240229", "20240301", "y", "", "20250301"},
+		{"20240229", "20240301", "y", "forward", "20250301"},
+		{"20240229", "20240301", "y", "clamp", "20250228"},
+		{"20240229", "20240301", "y", "skip", "20280229"},
+		{"20240229", "20250301", "y", "clamp", "20260228"},
+		{"20240229", "20270301", "y", "clamp", "20280229"},
+		{"20240131", "20240201", "m 31", "", "20240331"},
+		{"20240131", "20240201", "m 31", "skip", "20240331"},
+		{"20240131", "20240201", "m 31", "clamp", "20240229"},
+		{"20240131", "20240201", "m 31", "forward", "20240301"},
+		{"20240131", "20240301", "m 31", "forward", "20240331"},
+		{"20240131", "20240331", "m 31", "forward", "20240501"},
+		{"20240101", "20240301", "m 30 2", "clamp", "20250228"},
+		{"20240101", "20240301", "m 30 2", "forward", "20250301"},
+		{"20240131", "20240201", "FREQ=MONTHLY", "", "20240331"},
+		{"20240131", "20240201", "FREQ=MONTHLY", "clamp", "20240229"},
+		{"20240131", "20240201", "FREQ=MONTHLY", "forward", "20240301"},
+		{"20240229", "20240301", "FREQ=YEARLY", "", "20280229"},
+		{"20240229", "20240301", "FREQ=YEARLY", "clamp", "20250228"},
+		{"20240229", "20240301", "y +b", "clamp", "20250228"},
+		{"20240229", "20260301", "y +b", "clamp", "20270301"},
+	} {
+		urlPath := fmt.Sprintf("api/nextdate?now=%s&date=%s&repeat=%s&overflow=%s",
+			v.now, v.date, url.QueryEscape(v.repeat), v.overflow)
+		body, err := getBody(urlPath)
+		assert.NoError(t, err)
+		assert.Equal(t, v.want, strings.TrimSpace(string(body)), "%s %s %q %s", v.date, v.now, v.repeat, v.overflow)
+	}
+
+	// Перенесённое повторение не сдвигает следующие: день берётся из
+	// первой даты серии
+	for _, v := range []struct {
+		date, repeat, overflow string
+		want                   []string
+	}{
+		{"20240229", "y", "clamp", []string{"20250228", "20260228", "20270228", "20280229", "20290228"}},
+		{"20240229", "y", "forward", []string{"20250301", "20260301", "20270301", "20280229", "20290301"}},
+		{"20240131", "FREQ=MONTHLY", "clamp", []string{"20240229", "20240331", "20240430", "20240531", "20240630"}},
+		{"20240131", "FREQ=MONTHLY", "forward", []string{"20240301", "20240331", "20240501", "20240531", "20240701"}},
+	} {
+		urlPath := fmt.Sprintf("api/nextdate?now=20240201&date=%s&repeat=%s&overflow=%s&count=5",
+			v.date, url.QueryEscape(v.repeat), v.overflow)
+		body, err := getBody(urlPath)
+		assert.NoError(t, err)
+		var dates []string
+		assert.NoError(t, json.Unmarshal(body, &dates), string(body))
+		assert.Equal(t, v.want, dates, "%s %q %s", v.date, v.repeat, v.overflow)
+	}
+
+	body, err := getBody("api/nextdate?now=20240301&date=20240101&repeat=m%2030%202&overflow=skip")
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "no_occurrences")
+	body, err = getBody("api/nextdate?now=20240301&date=20240229&repeat=y&overflow=round")
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "overflow")
+
+	db := openDB(t)
+	defer db.Close()
+	_, err = requestJSON("api/task", map[string]any{
+		"title":    "День рождения 29 февраля",
+		"date":     "20320229",
+		"repeat":   "y",
+		"overflow": "clamp",
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	var task Task
+	err = db.Get(&task, `SELECT * FROM scheduler WHERE title = ?`, "День рождения 29 февраля")
+	assert.NoError(t, err)
+	assert.Equal(t, "clamp", task.Overflow)
+
+	_, err = requestJSON("api/task", map[string]any{
+		"title":    "Неверная политика",
+		"repeat":   "y",
+		"overflow": "round",
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	err = db.Get(&task, `SELECT * FROM scheduler WHERE title = ?`, "Неверная политика")
+	assert.Error(t, err)
+}
+
+func TestDoneOverflow(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	for _, v := range []struct {
+		date, repeat string
+		want         []string
+	}{
+		{"20280229", "y", []string{"20290228", "20300228", "20310228", "20320229"}},
+		{"20310131", "FREQ=MONTHLY", []string{"20310228", "20310331", "20310430", "20310531"}},
+	} {
+		ret, err := postJSON("api/task", map[string]any{
+			"title":    "Перенос в конец месяца " + v.repeat,
+			"date":     v.date,
+			"repeat":   v.repeat,
+			"overflow": "clamp",
+		}, http.MethodPost)
+		assert.NoError(t, err)
+		id, ok := ret["id"]
+		if !assert.True(t, ok, "не возвращён id: %v", ret) {
+			continue
+		}
+		// После выполнения задача переходит на последний день месяца, но
+		// следующие повторения снова считаются от исходного дня
+		for _, want := range v.want {
+			ret, err := postJSON("api/task/done?id="+fmt.Sprint(id), nil, http.MethodPost)
+			assert.NoError(t, err)
+			assert.Empty(t, ret)
+			var task Task
+			err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, id)
+			assert.NoError(t, err)
+			assert.Equal(t, want, task.Date, v.repeat)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type tasksPage struct {
+	Tasks      []map[string]string `json:"tasks"`
+	NextCursor string              `json:"next_cursor"`
+	Error      string              `json:"error"`
+}
+
+// allPages обходит список задач по курсорам и возвращает заголовки по порядку.
+func allPages(t *testing.T, query url.Values) []string {
+	var titles []string
+	for page := 0; page < 100; page++ {
+		body, err := requestJSON("api/tasks?"+query.Encode(), nil, http.MethodGet)
+		assert.NoError(t, err)
+		var p tasksPage
+		if !assert.NoError(t, json.Unmarshal(body, &p), string(body)) || !assert.Empty(t, p.Error) {
+			return titles
+		}
+		// Страница не длиннее limit и не пуста, если за ней есть следующая
+		if limit, err := strconv.Atoi(query.Get("limit")); err == nil {
+			assert.LessOrEqual(t, len(p.Tasks), limit, query)
+		}
+		if p.NextCursor != "" {
+			assert.NotEmpty(t, p.Tasks, query)
+		}
+		for _, task := range p.Tasks {
+			titles = append(titles, task["title"])
+		}
+		if p.NextCursor == "" {
+			return titles
+		}
+		query.Set("cursor", p.NextCursor)
+	}
+	t.Fatal("курсор не заканчивается")
+	return nil
+}
+
+func TestTasksPages(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	_, err := db.Exec("DELETE FROM scheduler")
+	assert.NoError(t, err)
+
+	// Несколько задач на одну дату: порядок внутри даты — по id
+	for _, v := range []struct {
+		title string
+		days  int
+	}{
+		{"Страница 5", 2}, {"Страница 3", 2}, {"Страница 7", 1}, {"Страница 1", 1},
+		{"Страница 6", 0}, {"Страница 2", 0}, {"Страница 4", 1}, {"Страница без даты", 0},
+	} {
+		addTask(t, task{date: now.AddDate(0, 0, v.days).Format(`20060102`), title: v.title})
+	}
+	_, err = db.Exec(`UPDATE scheduler SET date = '' WHERE title = ?`, "Страница без даты")
+	assert.NoError(t, err)
+
+	byCreated := []string{"Страница 5", "Страница 3", "Страница 7", "Страница 1",
+		"Страница 6", "Страница 2", "Страница 4", "Страница без даты"}
+	byDate := []string{"Страница 6", "Страница 2", "Страница 7", "Страница 1",
+		"Страница 4", "Страница 5", "Страница 3", "Страница без даты"}
+	byTitle := []string{"Страница 1", "Страница 2", "Страница 3", "Страница 4",
+		"Страница 5", "Страница 6", "Страница 7", "Страница без даты"}
+	for _, limit := range []string{"1", "2", "3", "50"} {
+		assert.Equal(t, byDate, allPages(t, url.Values{"limit": {limit}}), limit)
+		assert.Equal(t, byDate, allPages(t, url.Values{"limit": {limit}, "sort": {"date"}}), limit)
+		assert.Equal(t, byCreated, allPages(t, url.Values{"limit": {limit}, "sort": {"created"}}), limit)
+		assert.Equal(t, byTitle, allPages(t, url.Values{"limit": {limit}, "sort": {"title"}}), limit)
+		assert.Equal(t, []string{"Страница 7", "Страница 1", "Страница 4"},
+			allPages(t, url.Values{"limit": {limit}, "search": {now.AddDate(0, 0, 1).Format(`02.01.2006`)}}), limit)
+		assert.Equal(t, []string{"Страница без даты"},
+			allPages(t, url.Values{"limit": {limit}, "search": {"БЕЗ"}, "sort": {"title"}}), limit)
+	}
+
+	// Лимит считает записи: просроченные задачи с политикой each не
+	// занимают место на страницах поиска по другой дате, а их записи не
+	// переполняют страницу
+	for i := 0; i < 4; i++ {
+		_, err = db.Exec(`INSERT INTO scheduler (date, title, comment, repeat, catchup) VALUES (?, ?, '', 'd 7', 'each')`,
+			now.AddDate(0, 0, -20).Format(`20060102`), "Страница пропусков")
+		assert.NoError(t, err)
+	}
+	for _, limit := range []string{"1", "2", "3", "50"} {
+		assert.Equal(t, []string{"Страница 7", "Страница 1", "Страница 4"},
+			allPages(t, url.Values{"limit": {limit}, "search": {now.AddDate(0, 0, 1).Format(`02.01.2006`)}}), limit)
+		missed := 0
+		for _, title := range allPages(t, url.Values{"limit": {limit}}) {
+			if title == "Страница пропусков" {
+				missed++
+			}
+		}
+		// По три записи на задачу, но не больше limit
+		want, _ := strconv.Atoi(limit)
+		assert.Equal(t, 4*min(3, want), missed, limit)
+	}
+
+	// Отменённая дата не находится поиском по дате
+	res, err := db.Exec(`INSERT INTO scheduler (date, title, comment, repeat) VALUES ('20320105', ?, '', 'w 1')`,
+		"Страница отменённой планёрки")
+	assert.NoError(t, err)
+	id, err := res.LastInsertId()
+	assert.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO exdates (task_id, date) VALUES (?, '20320105')`, id)
+	assert.NoError(t, err)
+	assert.Empty(t, allPages(t, url.Values{"search": {"05.01.2032"}}))
+
+	// Курсор нельзя применить к другому порядку или поиску
+	body, err := requestJSON("api/tasks?limit=2", nil, http.MethodGet)
+	assert.NoError(t, err)
+	var p tasksPage
+	assert.NoError(t, json.Unmarshal(body, &p))
+	for _, query := range []string{
+		"sort=title&cursor=" + p.NextCursor,
+		"search=x&cursor=" + p.NextCursor,
+		"cursor=abc",
+		"sort=priority",
+		"limit=0",
+		"limit=1000",
+	} {
+		m, err := postJSON("api/tasks?"+query, nil, http.MethodGet)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, m["error"], query)
+	}
+
+	_, err = db.Exec("DELETE FROM scheduler")
+	assert.NoError(t, err)
+}
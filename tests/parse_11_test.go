@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseRepeat(t *testing.T, text string) map[string]any {
+	m, err := postJSON("api/repeat/parse", map[string]any{"text": text}, http.MethodPost)
+	assert.NoError(t, err)
+	return m
+}
+
+func TestRepeatParse(t *testing.T) {
+	for _, v := range []struct {
+		text   string
+		repeat string
+	}{
+		{"каждый день", "d 1"},
+		{"ежедневно", "d 1"},
+		{"каждые 3 дня", "d 3"},
+		{"раз в две недели", "d 14"},
+		{"каждую неделю по понедельникам", "w 1"},
+		{"по понедельникам и четвергам", "w 1,4"},
+		{"по будням", "w 1,2,3,4,5"},
+		{"каждые 2 недели по пятницам", "FREQ=WEEKLY;INTERVAL=2;BYDAY=FR"},
+		{"последний день месяца", "m -1"},
+		{"в предпоследний день месяца", "m -2"},
+		{"15-го числа каждого месяца", "m 15"},
+		{"1 и 15 числа в январе и июле", "m 1,15 1,7"},
+		{"15-го и в последний день месяца", "m 15,-1"},
+		{"во второй вторник месяца", "n 2:2"},
+		{"в первый понедельник и последнюю пятницу марта", "n 1:1,-1:5 3"},
+		{"каждый год", "y"},
+		{"ежемесячно", "FREQ=MONTHLY"},
+		{"каждые 3 месяца", "FREQ=MONTHLY;INTERVAL=3"},
+		{"каждые 3 рабочих дня", "b 3"},
+		{"каждый рабочий день", "b 1"},
+		{"по понедельникам с переносом на рабочий день", "w 1 +b"},
+		{"1 числа, кроме праздников", "m 1 !h"},
+		{"every day", "d 1"},
+		{"every other day", "d 2"},
+		{"every 2 weeks on Friday", "FREQ=WEEKLY;INTERVAL=2;BYDAY=FR"},
+		{"every Monday and Thursday", "w 1,4"},
+		{"every weekday", "w 1,2,3,4,5"},
+		{"on the 1st and 15th of every month", "m 1,15"},
+		{"last day of the month", "m -1"},
+		{"second to last day of the month", "m -2"},
+		{"the second Tuesday of the month", "n 2:2"},
+		{"last Friday in March", "n -1:5 3"},
+		{"every 3 business days", "b 3"},
+		{"annually", "y"},
+		{"every weekday skipping holidays", "w 1,2,3,4,5 !h"},
+	} {
+		m := parseRepeat(t, v.text)
+		assert.Equal(t, v.repeat, m["repeat"], "%q: %v", v.text, m)
+	}
+
+	// Результат годится для задачи
+	m := parseRepeat(t, "каждые 2 недели по пятницам")
+	body, err := requestJSON("api/task", map[string]any{
+		"title":  "Вынести мусор",
+		"repeat": m["repeat"],
+	}, http.MethodPost)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(body), "error")
+
+	body, err = getBody("api/repeat/parse?text=каждый%20понедельник")
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"w 1"`)
+
+	for _, v := range []struct {
+		text string
+		code string
+		pos  float64
+	}{
+		{"", "empty_rule", 0},
+		{"каждый понедельник кроме марта", "unknown_rule", 36},
+		{"every blue moon", "unknown_rule", 6},
+		{"32 числа", "invalid_value", 0},
+		{"в марте", "invalid_format", -1},
+		// Интервал не сочетается с днями недели и днями месяца
+		{"every 3 days on Friday", "conflict", 0},
+		{"every year on the 15th", "conflict", 0},
+		{"каждые 3 дня 15-го числа", "conflict", 0},
+		{"каждый день, 5 раз", "conflict", 0},
+		{"по будням каждый месяц", "conflict", 18},
+		// Строчная ⱥ длиннее заглавной Ⱥ в байтах
+		{"ȺȺȺȺ", "unknown_rule", 0},
+		{"ȺȺ каждый день", "unknown_rule", 0},
+	} {
+		m := parseRepeat(t, v.text)
+		assert.Equal(t, v.code, m["code"], "%q: %v", v.text, m)
+		assert.Equal(t, v.pos, m["position"], "%q: %v", v.text, m)
+		assert.NotEmpty(t, m["error"], v.text)
+	}
+
+	// Ошибка указывает на слово исходной фразы
+	body, err = getBody("api/repeat/parse?text=%C8%BA%C8%BA%C8%BA%C8%BA")
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"token":"ȺȺȺȺ"`)
+}
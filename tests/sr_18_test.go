@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextDateSpaced(t *testing.T) {
+	for _, v := range []struct {
+		repeat, grades string
+		want           string
+	}{
+		{"sr", "", "20240127"},
+		{"sr", "5", "20240127"},
+		{"sr", "5,5", "20240201"},
+		{"sr", "5,5,5", "20240211"},
+		{"sr", "4,4,4", "20240210"},
+		{"sr", "3,3,3", "20240208"},
+		{"sr", "5,5,2", "20240127"},
+		{"sr", "5,5,2,4,4", "20240201"},
+		{"sr 1.3", "5,5,5", "20240204"},
+		{"sr +b", "5,5", "20240201"},
+	} {
+		urlPath := fmt.Sprintf("api/nextdate?now=20240126&date=20240126&repeat=%s&grades=%s",
+			url.QueryEscape(v.repeat), v.grades)
+		body, err := getBody(urlPath)
+		assert.NoError(t, err)
+		assert.Equal(t, v.want, strings.TrimSpace(string(body)), "%s %s", v.repeat, v.grades)
+	}
+
+	// Интервал отсчитывается от более поздней из дат: задачи или сегодняшней
+	body, err := getBody("api/nextdate?now=20240126&date=20240120&repeat=sr&grades=5,5")
+	assert.NoError(t, err)
+	assert.Equal(t, "20240201", strings.TrimSpace(string(body)))
+
+	for _, v := range []repeatError{
+		{"sr 1.2", "invalid_value", "1.2", 3},
+		{"sr x", "invalid_value", "x", 3},
+		{"sr 2.5 3", "invalid_format", "3", 7},
+	} {
+		urlPath := fmt.Sprintf("api/nextdate?now=20240126&date=20240126&repeat=%s", url.QueryEscape(v.repeat))
+		body, err := getBody(urlPath)
+		assert.NoError(t, err)
+		var m map[string]any
+		assert.NoError(t, json.Unmarshal(body, &m), v.repeat)
+		assert.Equal(t, v.code, m["code"], v.repeat)
+		assert.Equal(t, v.token, m["token"], v.repeat)
+		assert.Equal(t, v.position, m["position"], v.repeat)
+	}
+
+	for _, grades := range []string{"6", "5,-1", "5,,4", "хорошо"} {
+		body, err := getBody("api/nextdate?now=20240126&date=20240126&repeat=sr&grades=" + url.QueryEscape(grades))
+		assert.NoError(t, err)
+		assert.Contains(t, string(body), "grades", grades)
+	}
+
+	assert.Contains(t, describeRepeat(t, "sr")["text"], "интервальное повторение")
+}
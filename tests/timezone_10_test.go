@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+// createTask создаёт задачу через API. Если code не пуст, ожидается ошибка
+// с этим кодом, и задача не должна сохраниться; иначе задача читается из
+// базы по возвращённому id.
+func createTask(t *testing.T, db *sqlx.DB, values map[string]any, code string) (Task, bool) {
+	var task Task
+	before, err := count(db)
+	assert.NoError(t, err)
+
+	m, err := postJSON("api/task", values, http.MethodPost)
+	if !assert.NoError(t, err, values) {
+		return task, false
+	}
+	if code != "" {
+		assert.NotEmpty(t, m["error"], "ожидается ошибка для %v", values)
+		assert.Equal(t, code, m["code"], values)
+		assert.Equal(t, float64(http.StatusBadRequest), m["status"], values)
+		assert.NotContains(t, m, "id", values)
+		after, err := count(db)
+		assert.NoError(t, err)
+		assert.Equal(t, before, after, "задача %v не должна сохраняться", values)
+		return task, false
+	}
+	id, ok := m["id"]
+	if !assert.True(t, ok, "не возвращён id для %v: %v", values, m) {
+		return task, false
+	}
+	err = db.Get(&task, `SELECT * FROM scheduler WHERE id=?`, fmt.Sprint(id))
+	return task, assert.NoError(t, err)
+}
+
+func TestTaskTimezone(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	// В самом восточном и самом западном поясах "сегодня" почти всегда
+	// разные даты
+	for _, v := range []struct {
+		time string
+		tz   string
+		code string
+	}{
+		{"16:00", "Pacific/Kiritimati", ""},
+		{"16:00", "Pacific/Pago_Pago", ""},
+		{"16:00", "Europe/Moscow", ""},
+		{"", "Asia/Novosibirsk", ""},
+		{"25:00", "", "bad_request"},
+		{"16", "", "bad_request"},
+		{"16:00", "Mars/Olympus", "bad_request"},
+	} {
+		task, ok := createTask(t, db, map[string]any{
+			"title": "Созвон",
+			"time":  v.time,
+			"tz":    v.tz,
+		}, v.code)
+		if !ok {
+			continue
+		}
+		loc, err := time.LoadLocation(v.tz)
+		assert.NoError(t, err)
+		assert.Equal(t, time.Now().In(loc).Format(`20060102`), task.Date, v.tz)
+		assert.Equal(t, v.time, task.Time, v.tz)
+		assert.Equal(t, v.tz, task.TZ)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// WorkCalendar определяет, какие дни считаются рабочими и праздничными.
+// Используется правилом "b N" и модификаторами "+b", "!b", "+h", "!h".
+type WorkCalendar interface {
+	IsWorkday(date time.Time) bool
+	IsHoliday(date time.Time) bool
+}
+
+// weekCalendar — календарь по умолчанию: рабочие дни с понедельника по
+// пятницу, праздников нет.
+type weekCalendar struct{}
+
+func (weekCalendar) IsWorkday(date time.Time) bool {
+	return date.Weekday() != time.Saturday && date.Weekday() != time.Sunday
+}
+
+func (weekCalendar) IsHoliday(date time.Time) bool {
+	return false
+}
+
+// workCalendar — календарь, по которому NextDate считает рабочие дни.
+var workCalendar WorkCalendar = weekCalendar{}
+
+// maxDaysOff — сколько нерабочих дней или пропущенных повторений подряд
+// допускается, прежде чем правило будет признано невыполнимым.
+const maxDaysOff = 366
+
+// isDayModifier проверяет, является ли часть правила модификатором:
+// "+b" — перенести на ближайший рабочий день, "!b" — пропустить повторение
+// в нерабочий день, "+h" и "!h" — то же самое только для праздников.
+func isDayModifier(text string) bool {
+	switch text {
+	case "+b", "!b", "+h", "!h":
+		return true
+	}
+	return false
+}
+
+// applyDayModifier применяет модификатор к вычисленной дате. Для пропуска
+// повторений next должна возвращать следующее повторение правила после
+// переданной даты.
+func applyDayModifier(modifier ruleToken, date time.Time, next func(time.Time) (time.Time, error)) (time.Time, error) {
+	suitable := workCalendar.IsWorkday
+	if modifier.text[1] == 'h' {
+		suitable = func(date time.Time) bool {
+			return !workCalendar.IsHoliday(date)
+		}
+	}
+
+	for i := 0; i < maxDaysOff; i++ {
+		if suitable(date) {
+			return date, nil
+		}
+		if modifier.text[0] == '+' {
+			date = date.AddDate(0, 0, 1)
+			continue
+		}
+		var err error
+		date, err = next(date)
+		if err != nil {
+			return date, err
+		}
+	}
+	return time.Time{}, newRepeatError(errCodeNoOccurrences, modifier,
+		"не удалось найти подходящий день для модификатора %s", modifier.text)
+}
+
+// nextWorkdayStep возвращает первую дату строго после from из ряда
+// "каждый n-й рабочий день, считая от start". Рабочие дни приходится
+// пересчитывать подряд, так как календарь может содержать праздники.
+func nextWorkdayStep(start, from time.Time, n int) (time.Time, error) {
+	date := start
+	count, daysOff := 0, 0
+	for {
+		date = date.AddDate(0, 0, 1)
+		if !workCalendar.IsWorkday(date) {
+			daysOff++
+			if daysOff >= maxDaysOff {
+				return time.Time{}, fmt.Errorf("в календаре нет рабочих дней после %s", date.Format("20060102"))
+			}
+			continue
+		}
+		daysOff = 0
+		count++
+		if count%n == 0 && date.After(from) {
+			return date, nil
+		}
+	}
+}